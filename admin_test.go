@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestCancelAllStopsPendingJobs(t *testing.T) {
+	fc := useFakeClock(t)
+	store := useStatusStore(t)
+	fs := useFakeSender(t)
+	swap(t, &pendingJobs, newJobRegistry())
+	t.Setenv("DELAY_DISTRIBUTION", "fixed")
+	t.Setenv("PROGRESS_STEPS", "0")
+
+	var wg sync.WaitGroup
+	for id := 1; id <= 2; id++ {
+		req := calcRequest{CalculationID: id, CallbackURL: "http://receiver"}
+		store.start(req)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handleAsync(context.Background(), req)
+		}()
+	}
+	fc.waitForWaiters(t, 2)
+
+	rec := serve(route(http.MethodPost, "/admin/cancel-all", cancelAllHandler), http.MethodPost, "/admin/cancel-all", "")
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"cancelled":2}` {
+		t.Fatalf("cancel-all: %d %s", rec.Code, rec.Body)
+	}
+	wg.Wait()
+	for id := 1; id <= 2; id++ {
+		if status, _ := store.get(id); status.Status != "cancelled" {
+			t.Errorf("calculation %d: status %q, want cancelled", id, status.Status)
+		}
+	}
+	if sent := fs.delivered(); len(sent) != 0 {
+		t.Fatalf("callbacks sent for cancelled jobs: %+v", sent)
+	}
+
+	// Повторный вызов отменять уже нечего
+	rec = serve(route(http.MethodPost, "/admin/cancel-all", cancelAllHandler), http.MethodPost, "/admin/cancel-all", "")
+	if rec.Body.String() != `{"cancelled":0}` {
+		t.Fatalf("second cancel-all: %s", rec.Body)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// batchRequest — несколько заявок в одном запросе.
+type batchRequest struct {
+	Calculations []calcRequest `json:"calculations" binding:"required,min=1,dive"`
+	// BatchCallbacks — результаты с одинаковым callback_url отправить одним
+	// колбэком-массивом ([]calcResult), когда будут готовы все.
+	BatchCallbacks bool `json:"batch_callbacks,omitempty"`
+}
+
+func batchHandler(c *gin.Context) {
+	if !isJSONContentType(c.GetHeader("Content-Type")) {
+		writeError(c, errUnsupportedMediaType("content type must be application/json"))
+		return
+	}
+
+	var batch batchRequest
+	if err := bindJSON(c, &batch); err != nil {
+		writeError(c, err)
+		return
+	}
+	if maxSize := getEnvInt("BATCH_MAX_SIZE", 100); len(batch.Calculations) > maxSize {
+		writeError(c, errValidation(fmt.Sprintf("calculations: at most %d allowed", maxSize)))
+		return
+	}
+	for i, req := range batch.Calculations {
+		if err := validateCalcRequest(req); err != nil {
+			writeError(c, errValidation(fmt.Sprintf("calculations[%d]: %v", i, err)))
+			return
+		}
+		if batch.BatchCallbacks {
+			if unsupported := batchCallbackConflict(req); unsupported != "" {
+				writeError(c, errValidation(fmt.Sprintf("calculations[%d]: %s is not supported with batch_callbacks", i, unsupported)))
+				return
+			}
+		}
+	}
+
+	for _, req := range batch.Calculations {
+		jobs.startBatch(req)
+	}
+
+	if !batch.BatchCallbacks {
+		for _, req := range batch.Calculations {
+			scheduleAsync(jobsCtx, batchPool(), req)
+		}
+	} else {
+		groups := map[string][]calcRequest{}
+		var order []string
+		for _, req := range batch.Calculations {
+			if _, ok := groups[req.CallbackURL]; !ok {
+				order = append(order, req.CallbackURL)
+			}
+			groups[req.CallbackURL] = append(groups[req.CallbackURL], req)
+		}
+		for _, url := range order {
+			go handleBatchGroup(jobsCtx, url, groups[url])
+		}
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "scheduled", "count": len(batch.Calculations)})
+}
+
+// batchCallbackConflict называет настройку заявки, которую нельзя применить
+// к общему колбэку-массиву, или возвращает пустую строку. Массив уходит
+// одним POST на группу, поэтому настройки доставки отдельных заявок в нём
+// не учесть.
+func batchCallbackConflict(req calcRequest) string {
+	switch {
+	// В общем колбэке-массиве {id} и {status} не определены
+	case hasCallbackPlaceholders(req.CallbackURL):
+		return "callback_url with placeholders"
+	case req.CallbackAcceptsGzip:
+		return "callback_accepts_gzip"
+	case req.AcceptedCallback:
+		return "accepted_callback"
+	case req.FallbackCallbackURL != "":
+		return "fallback_callback_url"
+	case req.CallbackTimeoutMs != 0:
+		return "callback_timeout_ms"
+	case req.CallbackMaxRetries != nil:
+		return "callback_max_retries"
+	}
+	return ""
+}
+
+// handleBatchGroup обрабатывает заявки с общим callback_url параллельно и
+// отправляет их результаты одним массивом. Отменённые заявки в массив не
+// попадают.
+func handleBatchGroup(ctx context.Context, url string, reqs []calcRequest) {
+	results := make([]*calcResult, len(reqs))
+	var wg sync.WaitGroup
+	for i, req := range reqs {
+		wg.Add(1)
+		batchPool().submit(ctx, req.Priority, func(ctx context.Context) {
+			defer wg.Done()
+			if result, ok := runJob(ctx, req); ok {
+				results[i] = &result
+			}
+		})
+	}
+	wg.Wait()
+
+	payloads := make([]calcResult, 0, len(results))
+	for _, r := range results {
+		if r != nil {
+			payloads = append(payloads, *r)
+		}
+	}
+	if len(payloads) == 0 {
+		return
+	}
+	sendBatchCallback(ctx, url, payloads)
+}
+
+// batchStreamHandler считает заявки пакета и отдаёт результаты в ответе в
+// формате NDJSON (по строке на заявку) по мере готовности, без колбэков.
+// callback_url в заявках не обязателен и игнорируется. Если клиент
+// отключился, оставшиеся заявки отменяются.
+func batchStreamHandler(c *gin.Context) {
+	if !isJSONContentType(c.GetHeader("Content-Type")) {
+		writeError(c, errUnsupportedMediaType("content type must be application/json"))
+		return
+	}
+
+	var batch batchRequest
+	if err := bindJSON(c, &batch); err != nil {
+		writeError(c, err)
+		return
+	}
+	if maxSize := getEnvInt("BATCH_MAX_SIZE", 100); len(batch.Calculations) > maxSize {
+		writeError(c, errValidation(fmt.Sprintf("calculations: at most %d allowed", maxSize)))
+		return
+	}
+	for i, req := range batch.Calculations {
+		if req.CalculationID == 0 {
+			writeError(c, errValidation(fmt.Sprintf("calculations[%d]: calculation_id is required", i)))
+			return
+		}
+		if err := validateCalculation(req); err != nil {
+			writeError(c, errValidation(fmt.Sprintf("calculations[%d]: %v", i, err)))
+			return
+		}
+	}
+
+	results := make(chan calcResult)
+	var wg sync.WaitGroup
+	ctx := c.Request.Context()
+	for _, req := range batch.Calculations {
+		jobs.startBatch(req)
+		wg.Add(1)
+		batchPool().submit(ctx, req.Priority, func(ctx context.Context) {
+			defer wg.Done()
+			if result, ok := runJob(ctx, req); ok {
+				select {
+				case results <- result:
+				case <-ctx.Done():
+				}
+			}
+		})
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+	enc := json.NewEncoder(c.Writer)
+	for result := range results {
+		if err := enc.Encode(result); err != nil {
+			log.Printf("batch stream write error: %v", err)
+			continue
+		}
+		c.Writer.Flush()
+	}
+}
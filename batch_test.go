@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBatchCallbacksSendOnePost(t *testing.T) {
+	useDeterministic(t)
+	useStatusStore(t)
+	fs := useFakeSender(t)
+
+	body := `{"batch_callbacks": true, "calculations": [
+		{"calculation_id": 1, "callback_url": "http://receiver/batch", "services": [{"id": 1, "price": 10, "price_type": "one_time", "quantity": 1}]},
+		{"calculation_id": 2, "callback_url": "http://receiver/batch", "services": [{"id": 1, "price": 20, "price_type": "one_time", "quantity": 1}]},
+		{"calculation_id": 3, "callback_url": "http://receiver/batch", "services": [{"id": 1, "price": 30, "price_type": "one_time", "quantity": 1}]}
+	]}`
+	rec := serve(route(http.MethodPost, "/process/batch", batchHandler), http.MethodPost, "/process/batch", body, "Content-Type", "application/json")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+
+	eventually(t, func() bool { return len(fs.delivered()) > 0 })
+	sent := fs.delivered()
+	if len(sent) != 1 || sent[0].URL != "http://receiver/batch" {
+		t.Fatalf("sent %d callbacks, want one POST to the shared callback_url", len(sent))
+	}
+	var results []calcResult
+	if err := json.Unmarshal(sent[0].Payload, &results); err != nil {
+		t.Fatalf("batch callback is not an array: %v", err)
+	}
+	totals := map[int]float64{}
+	for _, r := range results {
+		totals[r.CalculationID] = *r.TotalCost
+	}
+	if len(results) != 3 || totals[1] != 10 || totals[2] != 20 || totals[3] != 30 {
+		t.Fatalf("batch callback = %s", sent[0].Payload)
+	}
+}
+
+func TestBatchCallbacksRejectsPerItemDelivery(t *testing.T) {
+	router := route(http.MethodPost, "/process/batch", batchHandler)
+	for _, field := range []string{
+		`"callback_url": "http://receiver/{id}"`,
+		`"callback_url": "http://receiver", "callback_accepts_gzip": true`,
+		`"callback_url": "http://receiver", "accepted_callback": true`,
+		`"callback_url": "http://receiver", "fallback_callback_url": "http://backup"`,
+		`"callback_url": "http://receiver", "callback_timeout_ms": 500`,
+		`"callback_url": "http://receiver", "callback_max_retries": 0`,
+	} {
+		body := `{"batch_callbacks": true, "calculations": [{"calculation_id": 1, ` + field + `, "services": []}]}`
+		rec := serve(router, http.MethodPost, "/process/batch", body, "Content-Type", "application/json")
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "batch_callbacks") {
+			t.Errorf("%s: status %d: %s", field, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestBatchStreamReturnsNDJSON(t *testing.T) {
+	useDeterministic(t)
+	useStatusStore(t)
+	fs := useFakeSender(t)
+
+	body := `{"calculations": [
+		{"calculation_id": 1, "services": [{"id": 1, "price": 10, "price_type": "one_time", "quantity": 1}]},
+		{"calculation_id": 2, "services": [{"id": 1, "price": 20, "price_type": "one_time", "quantity": 1}]}
+	]}`
+	rec := serve(route(http.MethodPost, "/process/batch/stream", batchStreamHandler), http.MethodPost, "/process/batch/stream", body, "Content-Type", "application/json")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("status %d, Content-Type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	// Каждая строка — отдельный JSON-результат, в порядке готовности
+	totals := map[int]float64{}
+	lines := bufio.NewScanner(strings.NewReader(rec.Body.String()))
+	for lines.Scan() {
+		var r calcResult
+		if err := json.Unmarshal(lines.Bytes(), &r); err != nil {
+			t.Fatalf("line %q: %v", lines.Text(), err)
+		}
+		totals[r.CalculationID] = *r.TotalCost
+	}
+	if len(totals) != 2 || totals[1] != 10 || totals[2] != 20 {
+		t.Fatalf("stream:\n%s", rec.Body)
+	}
+	if sent := fs.delivered(); len(sent) != 0 {
+		t.Fatalf("stream sent callbacks: %+v", sent)
+	}
+}
+
+func TestBatchPoolIsolatedFromSingleRequests(t *testing.T) {
+	fc := useFakeClock(t)
+	useStatusStore(t)
+	fs := useFakeSender(t)
+	swap(t, &failureRate, 0.0)
+	swap(t, &pendingJobs, newJobRegistry())
+	t.Setenv("DELAY_DISTRIBUTION", "fixed")
+	t.Setenv("DELAY_MEAN", "10s")
+	t.Setenv("PROGRESS_STEPS", "0")
+	useWorkerPool(t, 1)
+	swap(t, &batchWorkers, newWorkerPool(1))
+	if batchPool() != batchWorkers {
+		t.Fatal("batch requests do not use BATCH_WORKERS")
+	}
+
+	// Пакет занимает свой единственный обработчик, вторая заявка ждёт в очереди
+	body := `{"calculations": [
+		{"calculation_id": 1, "callback_url": "http://receiver", "services": []},
+		{"calculation_id": 2, "callback_url": "http://receiver", "services": []}
+	]}`
+	rec := serve(route(http.MethodPost, "/process/batch", batchHandler), http.MethodPost, "/process/batch", body, "Content-Type", "application/json")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("batch: status %d: %s", rec.Code, rec.Body)
+	}
+	fc.waitForWaiters(t, 1)
+
+	// Одиночная заявка начинается сразу, не дожидаясь пакета
+	body = `{"calculation_id": 3, "callback_url": "http://receiver", "services": []}`
+	rec = serve(route(http.MethodPost, "/process", processHandler), http.MethodPost, "/process", body, "Content-Type", "application/json")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("single: status %d: %s", rec.Code, rec.Body)
+	}
+	fc.waitForWaiters(t, 2)
+
+	fc.Advance(10 * time.Second)
+	waitDelivered(t, 1)
+	waitDelivered(t, 3)
+	fc.waitForWaiters(t, 1)
+	fc.Advance(10 * time.Second)
+	waitDelivered(t, 2)
+	if n := len(fs.delivered()); n != 3 {
+		t.Fatalf("delivered %d callbacks, want 3", n)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// bundleRules — пакетные скидки (BUNDLE_RULES) вида "1+2:10,3+4+5:15": если в
+// заявке есть все услуги пакета, их стоимость снижается на процент.
+// Правила применяются по порядку, услуга из нескольких пакетов получает
+// скидки последовательно.
+var bundleRules []bundleRule
+
+type bundleRule struct {
+	serviceIDs []int
+	percent    float64
+}
+
+// appliedBundle — пакетная скидка в результате.
+type appliedBundle struct {
+	ServiceIDs []int   `json:"service_ids"`
+	Percent    float64 `json:"percent"`
+	Discount   float64 `json:"discount"`
+}
+
+// parseBundleRules разбирает BUNDLE_RULES.
+func parseBundleRules(value string) ([]bundleRule, error) {
+	var rules []bundleRule
+	for _, item := range splitList(value) {
+		idsStr, percentStr, ok := strings.Cut(item, ":")
+		if !ok {
+			return nil, fmt.Errorf("rule %q: missing discount percent", item)
+		}
+		percent, err := strconv.ParseFloat(strings.TrimSpace(percentStr), 64)
+		if err != nil || percent <= 0 || percent > 100 {
+			return nil, fmt.Errorf("rule %q: discount must be a percent in (0, 100]", item)
+		}
+		rule := bundleRule{percent: percent}
+		for _, idStr := range strings.Split(idsStr, "+") {
+			id, err := strconv.Atoi(strings.TrimSpace(idStr))
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: invalid service id %q", item, idStr)
+			}
+			rule.serviceIDs = append(rule.serviceIDs, id)
+		}
+		if len(rule.serviceIDs) < 2 {
+			return nil, fmt.Errorf("rule %q: bundle needs at least two services", item)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// applyBundleDiscounts снижает стоимость строк пакетов, все услуги которых
+// есть в заявке. Каждое правило применяется один раз, даже если услуга
+// встречается в нескольких строках.
+func applyBundleDiscounts(lines []pricedLine, rules []bundleRule) []appliedBundle {
+	present := map[int]bool{}
+	for _, pl := range lines {
+		present[pl.item.ID] = true
+	}
+	var applied []appliedBundle
+	for _, rule := range rules {
+		complete := true
+		members := map[int]bool{}
+		for _, id := range rule.serviceIDs {
+			complete = complete && present[id]
+			members[id] = true
+		}
+		if !complete {
+			continue
+		}
+		var discount float64
+		for _, pl := range lines {
+			if !members[pl.item.ID] {
+				continue
+			}
+			for k, cost := range pl.years {
+				cut := cost * rule.percent / 100
+				pl.years[k] -= cut
+				discount += cut
+			}
+		}
+		applied = append(applied, appliedBundle{ServiceIDs: rule.serviceIDs, Percent: rule.percent, Discount: discount})
+	}
+	return applied
+}
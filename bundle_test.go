@@ -0,0 +1,41 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBundleDiscount(t *testing.T) {
+	useDeterministic(t)
+	rules, err := parseBundleRules("1+2:10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	swap(t, &bundleRules, rules)
+	full := []serviceItem{
+		{ID: 1, Price: 10, PriceType: "monthly", Quantity: 1},
+		{ID: 2, Price: 100, PriceType: "one_time", Quantity: 1},
+		{ID: 3, Price: 5, PriceType: "monthly", Quantity: 1},
+	}
+
+	// Пакет целиком: 10 % от 120 + 100, услуга 3 без скидки
+	result := computeResult(calcRequest{Services: full})
+	want := []appliedBundle{{ServiceIDs: []int{1, 2}, Percent: 10, Discount: 22}}
+	if *result.TotalCost != 258 || !reflect.DeepEqual(result.Bundles, want) {
+		t.Fatalf("full bundle: total %v, bundles %+v", *result.TotalCost, result.Bundles)
+	}
+
+	// Без услуги 2 пакет неполный, скидки нет
+	result = computeResult(calcRequest{Services: []serviceItem{full[0], full[2]}})
+	if *result.TotalCost != 180 || result.Bundles != nil {
+		t.Fatalf("partial bundle: total %v, bundles %+v", *result.TotalCost, result.Bundles)
+	}
+}
+
+func TestParseBundleRulesRejectsInvalid(t *testing.T) {
+	for _, value := range []string{"1+2", "1:10", "1+2:0", "1+2:150", "1+x:10"} {
+		if _, err := parseBundleRules(value); err == nil {
+			t.Errorf("%q: expected an error", value)
+		}
+	}
+}
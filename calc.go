@@ -0,0 +1,666 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// oneTimePriceTypes — написания разовой оплаты (ONE_TIME_PRICE_TYPES).
+var oneTimePriceTypes = map[string]bool{"one_time": true, "onetime": true, "one-time": true, "once": true}
+
+// strictPriceTypes — отклонять услуги с price_type вне известных периодических
+// и разовых значений (STRICT_PRICE_TYPES). Без него неизвестный тип
+// считается разовой оплатой.
+var strictPriceTypes bool
+
+// allowedPriceTypes — price_type, которые принимает развёртывание
+// (ALLOWED_PRICE_TYPES). nil — без ограничения.
+var allowedPriceTypes map[string]bool
+
+// sameDayZeroDuration — как считать диапазон с start == end
+// (SAME_DAY_ZERO_DURATION). По умолчанию такой диапазон оплачивается как
+// минимальный период в 1 месяц; с флагом его длительность равна нулю и
+// платятся только разовые услуги — для работ, выполненных за один день.
+var sameDayZeroDuration bool
+
+// quantityZeroPolicy — что делать со строкой с quantity 0 или без него
+// (QUANTITY_ZERO_POLICY):
+//   - default-to-1 (по умолчанию) — считать одну единицу с предупреждением;
+//   - reject — отклонять строку как невалидную;
+//   - treat-as-zero — считать как есть, строка стоит 0.
+var quantityZeroPolicy = "default-to-1"
+
+// quantityDefaultWarnFraction — доля строк заявки с quantity, заменённым
+// на 1, сверх которой добавляется общее предупреждение
+// (QUANTITY_DEFAULT_WARN_FRACTION): массовая подстановка обычно означает
+// ошибку клиента, например неверное имя поля.
+var quantityDefaultWarnFraction = 0.5
+
+// parseQuantityZeroPolicy проверяет значение QUANTITY_ZERO_POLICY.
+func parseQuantityZeroPolicy(value string) (string, error) {
+	switch value {
+	case "default-to-1", "reject", "treat-as-zero":
+		return value, nil
+	}
+	return "", fmt.Errorf("unknown policy %q, expected default-to-1, reject or treat-as-zero", value)
+}
+
+// percentOfTotal — тип строки, цена которой — процент от суммы всех
+// остальных (непроцентных) строк, например комиссия 3%.
+const percentOfTotal = "percent_of_total"
+
+// normalizePriceType приводит price_type к каноническому виду: " Monthly "
+// и "MONTHLY" считаются monthly.
+func normalizePriceType(priceType string) string {
+	return strings.ToLower(strings.TrimSpace(priceType))
+}
+
+func isRecurringPriceType(priceType string) bool {
+	return priceType == "monthly" || priceType == "yearly" || priceType == "daily"
+}
+
+func isKnownPriceType(priceType string) bool {
+	return isRecurringPriceType(priceType) || oneTimePriceTypes[priceType] || priceType == percentOfTotal
+}
+
+// period — длительность строки: месяцы и, если известны даты, точное число дней.
+type period struct {
+	Months int
+	Days   int
+}
+
+// days возвращает точное число дней или, без дат, оценку по 30 дней в месяце.
+func (p period) days() int {
+	if p.Days > 0 {
+		return p.Days
+	}
+	return p.Months * 30
+}
+
+// calcOutcome — результат расчёта по списку услуг.
+type calcOutcome struct {
+	Total          float64
+	DurationMonths int
+	Skipped        []skippedItem
+	// Warnings — допущения, сделанные при расчёте вместо отказа.
+	Warnings []string
+	// YearlyTotals — стоимость по годам договора (с учётом индексации).
+	YearlyTotals []float64
+	// DurationDays — точное число дней самой длинной периодической строки
+	// (0, если даты не заданы).
+	DurationDays int
+	// OverageTotal — часть итога, приходящаяся на перерасход сверх included_units.
+	OverageTotal float64
+	// LineItems — стоимость каждой посчитанной строки.
+	LineItems []lineItem
+	// MinChargeApplied — ID строк, поднятых до min_charge.
+	MinChargeApplied []int
+	// Subtotals — стоимость по типам оплаты; разовые алиасы и неизвестные
+	// типы собираются под one_time.
+	Subtotals map[string]float64
+	// CategoryTotals — стоимость по category строк (uncategorized без неё).
+	CategoryTotals map[string]float64
+	// Bundles — применённые пакетные скидки (уже вычтены из Total).
+	Bundles []appliedBundle
+	// PromoSavings — скидка за промо-период (уже вычтена из Total).
+	PromoSavings float64
+	// Commitment — минимальный ежемесячный платёж по периодическим услугам
+	// (nil без monthly_commitment).
+	Commitment *commitmentSummary
+	// AvgUnitPrice — Total на суммарное количество непроцентных строк
+	// (0, если количество нулевое).
+	AvgUnitPrice float64
+	// QuantityDefaulted — quantity подставлен у доли строк больше
+	// quantityDefaultWarnFraction.
+	QuantityDefaulted bool
+	// Recurring — есть хотя бы одна периодическая строка. Без них
+	// DurationMonths — лишь значение по умолчанию.
+	Recurring bool
+}
+
+// commitmentSummary — сравнение периодических начислений с минимальным
+// обязательством за весь период.
+type commitmentSummary struct {
+	// Committed — обязательство: monthly_commitment × месяцы периода.
+	Committed float64 `json:"committed"`
+	// Actual — фактические периодические начисления.
+	Actual float64 `json:"actual"`
+	// Shortfall — доплата до обязательства, добавленная к итогу.
+	Shortfall float64 `json:"shortfall"`
+}
+
+// pricedLine — строка со стоимостью по годам до сложения в итоги.
+type pricedLine struct {
+	item      serviceItem
+	period    period
+	years     []float64
+	recurring bool
+}
+
+// uncategorized — категория строк без category.
+const uncategorized = "uncategorized"
+
+// addCategoryCost добавляет стоимость строки к её категории.
+func (out *calcOutcome) addCategoryCost(category string, cost float64) {
+	if category == "" {
+		category = uncategorized
+	}
+	if out.CategoryTotals == nil {
+		out.CategoryTotals = map[string]float64{}
+	}
+	out.CategoryTotals[category] += cost
+}
+
+// lineItem — строка детализации расчёта (include_breakdown).
+type lineItem struct {
+	ID        int     `json:"id"`
+	PriceType string  `json:"price_type"`
+	Quantity  int     `json:"quantity"`
+	Months    int     `json:"months,omitempty"`
+	Cost      float64 `json:"cost"`
+}
+
+// skippedItem описывает услугу, пропущенную при расчёте в режиме partial.
+type skippedItem struct {
+	ID     int    `json:"id"`
+	Reason string `json:"reason"`
+}
+
+// validateService проверяет одну строку заявки.
+func validateService(it serviceItem) error {
+	if math.IsInf(it.Price, 0) || math.IsNaN(it.Price) {
+		return errors.New("price must be a finite number")
+	}
+	if it.Price < 0 {
+		return errors.New("price must not be negative")
+	}
+	if it.Quantity < 0 {
+		return errors.New("quantity must not be negative")
+	}
+	if it.Quantity == 0 && quantityZeroPolicy == "reject" {
+		return errors.New("quantity must be positive")
+	}
+	if math.IsInf(it.MinCharge, 0) || math.IsNaN(it.MinCharge) || it.MinCharge < 0 {
+		return errors.New("min_charge must be a non-negative number")
+	}
+	if it.IncludedUnits < 0 {
+		return errors.New("included_units must not be negative")
+	}
+	if math.IsInf(it.OveragePrice, 0) || math.IsNaN(it.OveragePrice) || it.OveragePrice < 0 {
+		return errors.New("overage_price must be a non-negative number")
+	}
+	if strictPriceTypes && !isKnownPriceType(normalizePriceType(it.PriceType)) {
+		return fmt.Errorf("unknown price_type %q", it.PriceType)
+	}
+	return nil
+}
+
+// calcOptions — параметры расчёта из заявки.
+type calcOptions struct {
+	// AnnualIncreasePercent — ежегодная индексация периодических услуг.
+	AnnualIncreasePercent float64
+	// BillingAnchorDay и PartialMonthRounding — как считать месяцы по датам
+	// строк (см. durationFromDates).
+	BillingAnchorDay     int
+	PartialMonthRounding string
+	// RequestDays — точное число дней периода заявки (0, если дат нет).
+	RequestDays int
+	// PromoMonths — первые месяцы периодических услуг, на которые действует
+	// скидка PromoDiscountPercent (см. applyPromo).
+	PromoMonths          int
+	PromoDiscountPercent float64
+	// MonthlyCommitment — минимальные периодические начисления в месяц
+	// (см. applyCommitment).
+	MonthlyCommitment float64
+}
+
+// calculate считает стоимость и период. Невалидные услуги пропускаются и
+// попадают в Skipped — в обычном режиме processHandler отсекает их заранее.
+func calculate(items []serviceItem, monthsOverride *int, opts calcOptions) calcOutcome {
+	var out calcOutcome
+	var total float64
+	// requestMonths — период заявки для строк без собственных дат,
+	// durationMonths — итоговый период (самая длинная периодическая строка).
+	requestMonths := 12
+	durationMonths := 0
+	// Нулевой период бывает только у однодневной заявки (sameDayZeroDuration)
+	hasPeriod := monthsOverride != nil && (*monthsOverride > 0 || sameDayZeroDuration)
+	if hasPeriod {
+		requestMonths = *monthsOverride
+		durationMonths = *monthsOverride
+	}
+
+	// Процентные строки считаются вторым проходом от суммы остальных
+	var percentLines []serviceItem
+	// priced — посчитанные непроцентные строки до сложения в итоги
+	var priced []pricedLine
+	// quantity — суммарное количество непроцентных строк для AvgUnitPrice
+	quantity := 0
+	// defaulted — число строк, где quantity заменён на 1
+	defaulted := 0
+
+	for _, it := range items {
+		it.PriceType = normalizePriceType(it.PriceType)
+		if err := validateService(it); err != nil {
+			out.Skipped = append(out.Skipped, skippedItem{ID: it.ID, Reason: err.Error()})
+			continue
+		}
+		if it.Quantity <= 0 && quantityZeroPolicy == "default-to-1" {
+			out.Warnings = append(out.Warnings, fmt.Sprintf("service %d: quantity %d defaulted to 1", it.ID, it.Quantity))
+			it.Quantity = 1
+			defaulted++
+		}
+		if it.PriceType == percentOfTotal {
+			percentLines = append(percentLines, it)
+			continue
+		}
+		if !isKnownPriceType(it.PriceType) {
+			out.Warnings = append(out.Warnings, fmt.Sprintf("service %d: unknown price_type %q treated as one_time", it.ID, it.PriceType))
+		}
+		p := period{Months: requestMonths, Days: opts.RequestDays}
+		if it.StartDate != "" || it.EndDate != "" {
+			if lineMonths := durationFromDateStrings(it.StartDate, it.EndDate, opts.BillingAnchorDay, opts.PartialMonthRounding); lineMonths != nil {
+				p = period{Months: *lineMonths, Days: *daysFromDateStrings(it.StartDate, it.EndDate)}
+			} else {
+				out.Warnings = append(out.Warnings, fmt.Sprintf("service %d: dates ignored, using request period", it.ID))
+			}
+		}
+		years, recurring := lineCostByYear(it, p, opts.AnnualIncreasePercent)
+		// Доля перерасхода считается до применения min_charge
+		if base, overage := lineBase(it); overage > 0 {
+			var lineTotal float64
+			for _, cost := range years {
+				lineTotal += cost
+			}
+			out.OverageTotal += lineTotal * overage / base
+		}
+		if recurring {
+			out.PromoSavings += applyPromo(years, it.PriceType, p, opts.PromoMonths, opts.PromoDiscountPercent)
+		}
+		if floored := applyMinCharge(years, it.MinCharge); floored {
+			out.MinChargeApplied = append(out.MinChargeApplied, it.ID)
+		}
+		priced = append(priced, pricedLine{item: it, period: p, years: years, recurring: recurring})
+	}
+
+	if defaulted > 0 && float64(defaulted) > quantityDefaultWarnFraction*float64(len(items)) {
+		out.Warnings = append(out.Warnings, fmt.Sprintf("quantity defaulted to 1 for %d of %d services, check the request", defaulted, len(items)))
+		out.QuantityDefaulted = true
+	}
+
+	// Скидки — до процентных строк: комиссия считается от суммы со скидкой
+	out.Bundles = applyBundleDiscounts(priced, bundleRules)
+
+	// recurringYears — периодические начисления по годам для MonthlyCommitment
+	var recurringYears []float64
+	for _, pl := range priced {
+		it, p, years, recurring := pl.item, pl.period, pl.years, pl.recurring
+		group := "one_time"
+		if recurring {
+			group = it.PriceType
+		}
+		if out.Subtotals == nil {
+			out.Subtotals = map[string]float64{}
+		}
+		line := lineItem{ID: it.ID, PriceType: it.PriceType, Quantity: it.Quantity}
+		if recurring {
+			line.Months = p.Months
+		}
+		for k, cost := range years {
+			if k == len(out.YearlyTotals) {
+				out.YearlyTotals = append(out.YearlyTotals, 0)
+			}
+			out.YearlyTotals[k] += cost
+			out.Subtotals[group] += cost
+			line.Cost += cost
+			total += cost
+			if recurring {
+				if k == len(recurringYears) {
+					recurringYears = append(recurringYears, 0)
+				}
+				recurringYears[k] += cost
+			}
+		}
+		out.addCategoryCost(it.Category, line.Cost)
+		out.LineItems = append(out.LineItems, line)
+		quantity += it.Quantity
+		out.Recurring = out.Recurring || recurring
+		if recurring && durationMonths < p.Months {
+			durationMonths = p.Months
+		}
+		if recurring && out.DurationDays < p.Days {
+			out.DurationDays = p.Days
+		}
+	}
+
+	// Обязательство — до процентных строк: комиссия берётся и с доплаты
+	if opts.MonthlyCommitment > 0 && out.Recurring {
+		out.Commitment = applyCommitment(&out, recurringYears, durationMonths, opts.MonthlyCommitment)
+		total += out.Commitment.Shortfall
+	}
+
+	// Каждая процентная строка считается от одной и той же базы — суммы
+	// непроцентных строк, поэтому порядок процентных строк не влияет на итог
+	base := append([]float64(nil), out.YearlyTotals...)
+	for _, it := range percentLines {
+		rate := it.Price / 100 * float64(it.Quantity)
+		years := make([]float64, len(base))
+		for k, b := range base {
+			years[k] = b * rate
+		}
+		if floored := applyMinCharge(years, it.MinCharge); floored {
+			out.MinChargeApplied = append(out.MinChargeApplied, it.ID)
+		}
+		if out.Subtotals == nil {
+			out.Subtotals = map[string]float64{}
+		}
+		line := lineItem{ID: it.ID, PriceType: it.PriceType, Quantity: it.Quantity}
+		for k, cost := range years {
+			out.YearlyTotals[k] += cost
+			out.Subtotals[percentOfTotal] += cost
+			line.Cost += cost
+			total += cost
+		}
+		out.addCategoryCost(it.Category, line.Cost)
+		out.LineItems = append(out.LineItems, line)
+	}
+
+	if durationMonths == 0 && !hasPeriod {
+		durationMonths = 12
+	}
+
+	out.Total = total
+	if quantity > 0 {
+		out.AvgUnitPrice = total / float64(quantity)
+	}
+	out.DurationMonths = durationMonths
+	return out
+}
+
+// roundUnitPrices округляет цены за единицу до точности валюты до умножения
+// на количество и период (ROUND_UNIT_PRICE) — так итог совпадает с
+// биллингом, который хранит цены уже округлёнными. Процент percent_of_total
+// ценой за единицу не является и не округляется. Исходный срез не меняется.
+func roundUnitPrices(items []serviceItem, precision int) []serviceItem {
+	rounded := make([]serviceItem, len(items))
+	for i, it := range items {
+		if normalizePriceType(it.PriceType) != percentOfTotal {
+			it.Price = roundTo(it.Price, precision)
+			it.OveragePrice = roundTo(it.OveragePrice, precision)
+		}
+		rounded[i] = it
+	}
+	return rounded
+}
+
+// applyMinCharge поднимает стоимость строки до минимальной, добавляя
+// недостающее к первому году. Возвращает true, если строка была поднята.
+func applyMinCharge(years []float64, minCharge float64) bool {
+	if minCharge <= 0 || len(years) == 0 {
+		return false
+	}
+	var sum float64
+	for _, y := range years {
+		sum += y
+	}
+	if sum >= minCharge {
+		return false
+	}
+	years[0] += minCharge - sum
+	return true
+}
+
+// applyPromo снижает на percent стоимость первых promoMonths месяцев
+// периодической строки и возвращает размер скидки. Скидка внутри года
+// пропорциональна доле промо-периода в нём: для yearly год — 12 месяцев,
+// для daily промо-месяц — 30 дней, как в period.days(). Промо длиннее
+// периода строки распространяется на весь период.
+func applyPromo(years []float64, priceType string, p period, promoMonths int, percent float64) float64 {
+	if promoMonths <= 0 || percent <= 0 {
+		return 0
+	}
+	remaining := promoMonths
+	// units — длина года k в единицах оплаты (месяцах или днях)
+	units := func(k int) int { return min(12, p.Months-k*12) }
+	switch priceType {
+	case "daily":
+		remaining = promoMonths * 30
+		units = func(k int) int { return min(365, p.days()-k*365) }
+	case "yearly":
+		units = func(int) int { return 12 }
+	}
+	var savings float64
+	for k := range years {
+		if remaining <= 0 {
+			break
+		}
+		n := units(k)
+		if n <= 0 {
+			break
+		}
+		covered := min(remaining, n)
+		cut := years[k] * float64(covered) / float64(n) * percent / 100
+		years[k] -= cut
+		savings += cut
+		remaining -= covered
+	}
+	return savings
+}
+
+// applyCommitment поднимает периодические начисления каждого года договора
+// до monthly × месяцев этого года и добавляет доплату к YearlyTotals и
+// Subtotals["commitment"]. Сверка по годам, а не по месяцам: внутри года
+// цена периодических строк постоянна.
+func applyCommitment(out *calcOutcome, recurringYears []float64, months int, monthly float64) *commitmentSummary {
+	summary := &commitmentSummary{Committed: monthly * float64(months)}
+	for k := 0; k*12 < months; k++ {
+		var actual float64
+		if k < len(recurringYears) {
+			actual = recurringYears[k]
+		}
+		summary.Actual += actual
+		shortfall := monthly*float64(min(12, months-k*12)) - actual
+		if shortfall <= 0 {
+			continue
+		}
+		for k >= len(out.YearlyTotals) {
+			out.YearlyTotals = append(out.YearlyTotals, 0)
+		}
+		out.YearlyTotals[k] += shortfall
+		out.Subtotals["commitment"] += shortfall
+		summary.Shortfall += shortfall
+	}
+	// Строки с собственными датами могут выйти за период заявки
+	for k := (months + 11) / 12; k < len(recurringYears); k++ {
+		summary.Actual += recurringYears[k]
+	}
+	return summary
+}
+
+// lineBase — стоимость строки за единицу периода. Для тарификации по
+// потреблению (included_units/overage_price) Quantity — потреблённые
+// единицы: до included_units по price, сверх — по overage_price. Второе
+// значение — доля перерасхода в этой стоимости.
+func lineBase(it serviceItem) (float64, float64) {
+	if it.IncludedUnits <= 0 && it.OveragePrice <= 0 {
+		return it.Price * float64(it.Quantity), 0
+	}
+	included := min(it.Quantity, it.IncludedUnits)
+	overage := it.OveragePrice * float64(it.Quantity-included)
+	return it.Price*float64(included) + overage, overage
+}
+
+// lineCost возвращает стоимость строки за период p и признак того,
+// что услуга периодическая.
+func lineCost(it serviceItem, p period) (float64, bool) {
+	years, recurring := lineCostByYear(it, p, 0)
+	var total float64
+	for _, y := range years {
+		total += y
+	}
+	return total, recurring
+}
+
+// lineCostByYear раскладывает стоимость строки по годам договора. Цена
+// периодической услуги ежегодно растёт на increasePercent со сложным
+// процентом: год k (с нуля) стоит price * (1 + p/100)^k. Разовая оплата
+// целиком относится к первому году. Посуточная оплата считается по точному
+// числу дней, год для неё — 365 дней.
+func lineCostByYear(it serviceItem, p period, increasePercent float64) ([]float64, bool) {
+	base, _ := lineBase(it)
+	factor := 1 + increasePercent/100
+	months := p.Months
+	switch normalizePriceType(it.PriceType) {
+	case "daily":
+		days := p.days()
+		years := make([]float64, 0, (days+364)/365)
+		for k := 0; k*365 < days; k++ {
+			daysInYear := min(365, days-k*365)
+			years = append(years, base*float64(daysInYear)*math.Pow(factor, float64(k)))
+		}
+		return years, true
+	case "monthly":
+		years := make([]float64, 0, (months+11)/12)
+		for k := 0; k*12 < months; k++ {
+			monthsInYear := min(12, months-k*12)
+			years = append(years, base*float64(monthsInYear)*math.Pow(factor, float64(k)))
+		}
+		return years, true
+	case "yearly":
+		n := (months + 11) / 12 // ceil
+		years := make([]float64, n)
+		for k := range years {
+			years[k] = base * math.Pow(factor, float64(k))
+		}
+		return years, true
+	default: // разовая оплата (см. oneTimePriceTypes) или неизвестный тип
+		return []float64{base}, false
+	}
+}
+
+func durationFromDateStrings(start, end string, anchorDay int, partial string) *int {
+	if start == "" || end == "" {
+		return nil
+	}
+	startTime, err1 := parseDateOnly(start)
+	endTime, err2 := parseDateOnly(end)
+	if err1 != nil || err2 != nil {
+		return nil
+	}
+	return durationFromDates(startTime, endTime, anchorDay, partial)
+}
+
+// daysFromDateStrings — точное число дней между датами или nil, если их
+// не разобрать.
+func daysFromDateStrings(start, end string) *int {
+	if start == "" || end == "" {
+		return nil
+	}
+	startTime, err1 := parseDateOnly(start)
+	endTime, err2 := parseDateOnly(end)
+	if err1 != nil || err2 != nil {
+		return nil
+	}
+	return daysBetween(startTime, endTime)
+}
+
+// daysBetween — число дней в [start, end); не меньше нуля.
+func daysBetween(start, end time.Time) *int {
+	days := int(end.Sub(start).Hours() / 24)
+	if days < 0 {
+		days = 0
+	}
+	return &days
+}
+
+// checkDates сообщает, почему из переданных дат нельзя получить период.
+// durationFromDateStrings в таких случаях молча возвращает nil.
+func checkDates(start, end string) error {
+	if start == "" && end == "" {
+		return nil
+	}
+	if start == "" || end == "" {
+		return errors.New("start_date and end_date must be provided together")
+	}
+	startTime, err := parseDateOnly(start)
+	if err != nil {
+		return errors.New("start_date: must be a date in YYYY-MM-DD format")
+	}
+	endTime, err := parseDateOnly(end)
+	if err != nil {
+		return errors.New("end_date: must be a date in YYYY-MM-DD format")
+	}
+	// Даты без времени, поэтому допуск влияет, только если он не меньше суток
+	if endTime.Before(startTime.Add(-clockSkewTolerance())) {
+		return errors.New("end_date must not be before start_date")
+	}
+	return nil
+}
+
+// durationFromDates считает число оплачиваемых месяцев между датами.
+//
+// Без якорного дня (anchorDay == 0) неполный месяц учитывается по
+// политике partial (partial_month_rounding):
+//   - day-compare (по умолчанию, и пустое значение) — добавляется, если
+//     день end больше дня start;
+//   - ceil-any-partial — добавляется, если после полных месяцев остался
+//     хотя бы один день;
+//   - round-half — добавляется, если остаток не меньше половины месяца,
+//     следующего за полными.
+//
+// С якорным днём A расчётный месяц длится с A-го числа до A-го числа
+// следующего месяца, и считается число расчётных месяцев, которые задевает
+// диапазон [start, end): любой частично задетый месяц оплачивается целиком.
+// Например, при A=1 диапазон 10.01–20.03 задевает январь, февраль и март
+// (3 месяца), а при A=15 — периоды с 15.12, 15.01, 15.02 и 15.03 (4 месяца).
+//
+// Результат не меньше 1 месяца. Исключение — start == end при
+// sameDayZeroDuration: тогда период нулевой.
+func durationFromDates(start, end time.Time, anchorDay int, partial string) *int {
+	var months int
+	if sameDayZeroDuration && start.Equal(end) {
+		return &months
+	}
+	if anchorDay > 0 {
+		last := end.AddDate(0, 0, -1)
+		months = billingPeriodIndex(last, anchorDay) - billingPeriodIndex(start, anchorDay) + 1
+	} else if partial == "ceil-any-partial" || partial == "round-half" {
+		months = fullMonths(start, end)
+		from, next := start.AddDate(0, months, 0), start.AddDate(0, months+1, 0)
+		rest, month := end.Sub(from), next.Sub(from)
+		if (partial == "ceil-any-partial" && rest > 0) || (partial == "round-half" && 2*rest >= month) {
+			months++
+		}
+	} else {
+		months = (end.Year()-start.Year())*12 + int(end.Month()-start.Month())
+		if end.Day() > start.Day() {
+			months++
+		}
+	}
+	if months <= 0 {
+		months = 1
+	}
+	return &months
+}
+
+// fullMonths — число полных месяцев от start, укладывающихся до end.
+func fullMonths(start, end time.Time) int {
+	months := (end.Year()-start.Year())*12 + int(end.Month()-start.Month())
+	for months > 0 && start.AddDate(0, months, 0).After(end) {
+		months--
+	}
+	return max(months, 0)
+}
+
+// billingPeriodIndex — порядковый номер расчётного месяца, в который попадает t:
+// дни до якорного относятся к периоду, начавшемуся в предыдущем месяце.
+func billingPeriodIndex(t time.Time, anchorDay int) int {
+	idx := t.Year()*12 + int(t.Month())
+	if t.Day() < anchorDay {
+		idx--
+	}
+	return idx
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestOneTimePriceTypeAliases(t *testing.T) {
+	for alias := range oneTimePriceTypes {
+		out := calculate([]serviceItem{{ID: 1, Price: 50, PriceType: alias, Quantity: 1}}, nil, calcOptions{})
+		if out.Total != 50 || out.Recurring || len(out.Warnings) != 0 {
+			t.Errorf("%s: total %v, recurring %t, warnings %q; want a one-time 50", alias, out.Total, out.Recurring, out.Warnings)
+		}
+	}
+
+	// ONE_TIME_PRICE_TYPES заменяет набор написаний
+	swap(t, &oneTimePriceTypes, map[string]bool{"setup": true})
+	out := calculate([]serviceItem{{ID: 1, Price: 50, PriceType: "setup", Quantity: 1}}, nil, calcOptions{})
+	if out.Total != 50 || len(out.Warnings) != 0 {
+		t.Fatalf("setup: total %v, warnings %q", out.Total, out.Warnings)
+	}
+	out = calculate([]serviceItem{{ID: 2, Price: 50, PriceType: "once", Quantity: 1}}, nil, calcOptions{})
+	if len(out.Warnings) != 1 || !strings.Contains(out.Warnings[0], `unknown price_type "once" treated as one_time`) {
+		t.Fatalf("once after override: warnings %q", out.Warnings)
+	}
+}
+
+func TestStrictPriceTypesRejectsUnknown(t *testing.T) {
+	weekly := serviceItem{ID: 1, Price: 10, PriceType: "weekly", Quantity: 1}
+	if err := validateService(weekly); err != nil {
+		t.Fatalf("without STRICT_PRICE_TYPES: %v", err)
+	}
+
+	swap(t, &strictPriceTypes, true)
+	if err := validateService(weekly); err == nil || err.Error() != `unknown price_type "weekly"` {
+		t.Fatalf("with STRICT_PRICE_TYPES: err = %v", err)
+	}
+	if err := validateService(serviceItem{ID: 2, Price: 10, PriceType: "one-time", Quantity: 1}); err != nil {
+		t.Fatalf("known alias with STRICT_PRICE_TYPES: %v", err)
+	}
+}
+
+// months разыменовывает результат durationFromDates; nil даёт -1.
+func months(p *int) int {
+	if p == nil {
+		return -1
+	}
+	return *p
+}
+
+func TestBillingAnchorDay(t *testing.T) {
+	for _, tc := range []struct {
+		start, end string
+		anchor     int
+		want       int
+	}{
+		// Задеты январь, февраль и март
+		{"2025-01-10", "2025-03-20", 1, 3},
+		// Задеты периоды с 15.12, 15.01, 15.02 и 15.03
+		{"2025-01-10", "2025-03-20", 15, 4},
+		// Ровно один расчётный месяц
+		{"2025-01-15", "2025-02-15", 15, 1},
+		{"2025-01-14", "2025-02-15", 15, 2},
+		// Без якоря — сравнение дней
+		{"2025-01-10", "2025-03-20", 0, 3},
+	} {
+		if got := months(durationFromDateStrings(tc.start, tc.end, tc.anchor, "")); got != tc.want {
+			t.Errorf("%s..%s anchor %d: %d months, want %d", tc.start, tc.end, tc.anchor, got, tc.want)
+		}
+	}
+
+	useDeterministic(t)
+	result := computeResult(calcRequest{
+		StartDate:        "2025-01-10",
+		EndDate:          "2025-03-20",
+		BillingAnchorDay: 15,
+		Services:         []serviceItem{{ID: 1, Price: 100, PriceType: "monthly", Quantity: 1}},
+	})
+	if *result.DurationMonths != 4 || *result.TotalCost != 400 {
+		t.Fatalf("anchor 15: %d months, total %v; want 4 months, 400", *result.DurationMonths, *result.TotalCost)
+	}
+}
+
+func TestAnnualIncreaseCompounds(t *testing.T) {
+	items := []serviceItem{
+		{ID: 1, Price: 100, PriceType: "monthly", Quantity: 1},
+		{ID: 2, Price: 50, PriceType: "one_time", Quantity: 1},
+	}
+	for _, tc := range []struct {
+		months int
+		years  []float64
+	}{
+		{12, []float64{1250}},
+		{24, []float64{1250, 1260}},
+		{36, []float64{1250, 1260, 1323}},
+	} {
+		out := calculate(items, &tc.months, calcOptions{AnnualIncreasePercent: 5})
+		var total float64
+		for k, want := range tc.years {
+			if got := roundTo(out.YearlyTotals[k], 2); got != want {
+				t.Errorf("%d months: year %d = %v, want %v", tc.months, k+1, got, want)
+			}
+			total += want
+		}
+		if len(out.YearlyTotals) != len(tc.years) || roundTo(out.Total, 2) != total {
+			t.Errorf("%d months: total %v over %d years, want %v over %d", tc.months, out.Total, len(out.YearlyTotals), total, len(tc.years))
+		}
+	}
+}
+
+func TestServiceDatesOverrideRequestPeriod(t *testing.T) {
+	requestMonths := 12
+	out := calculate([]serviceItem{
+		{ID: 1, Price: 10, PriceType: "monthly", Quantity: 1},
+		{ID: 2, Price: 10, PriceType: "monthly", Quantity: 1, StartDate: "2025-03-01", EndDate: "2025-06-01"},
+	}, &requestMonths, calcOptions{})
+	if out.Total != 150 || out.DurationMonths != 12 {
+		t.Fatalf("total %v over %d months, want 150 over 12", out.Total, out.DurationMonths)
+	}
+	if out.LineItems[0].Months != 12 || out.LineItems[1].Months != 3 {
+		t.Fatalf("line months = %d, %d; want 12, 3", out.LineItems[0].Months, out.LineItems[1].Months)
+	}
+
+	// Период результата — самая длинная периодическая строка
+	out = calculate([]serviceItem{
+		{ID: 1, Price: 10, PriceType: "monthly", Quantity: 1},
+		{ID: 3, Price: 10, PriceType: "monthly", Quantity: 1, StartDate: "2025-01-01", EndDate: "2027-01-01"},
+	}, &requestMonths, calcOptions{})
+	if out.Total != 360 || out.DurationMonths != 24 {
+		t.Fatalf("total %v over %d months, want 360 over 24", out.Total, out.DurationMonths)
+	}
+}
+
+func TestMinChargeFloor(t *testing.T) {
+	months := 3
+	out := calculate([]serviceItem{
+		{ID: 1, Price: 10, PriceType: "monthly", Quantity: 1, MinCharge: 100},
+		{ID: 2, Price: 50, PriceType: "monthly", Quantity: 1, MinCharge: 100},
+		{ID: 3, Price: 5, PriceType: "one_time", Quantity: 1, MinCharge: 20},
+	}, &months, calcOptions{})
+	// 30 поднимается до 100, 150 остаётся, 5 поднимается до 20
+	if out.Total != 270 {
+		t.Fatalf("total = %v, want 270", out.Total)
+	}
+	if !reflect.DeepEqual(out.MinChargeApplied, []int{1, 3}) {
+		t.Fatalf("min_charge_applied = %v, want [1 3]", out.MinChargeApplied)
+	}
+}
+
+func TestPercentOfTotalLines(t *testing.T) {
+	months := 12
+	out := calculate([]serviceItem{
+		{ID: 1, Price: 100, PriceType: "monthly", Quantity: 1},
+		{ID: 2, Price: 800, PriceType: "one_time", Quantity: 1},
+		{ID: 3, Price: 3, PriceType: "percent_of_total", Quantity: 1},
+		{ID: 4, Price: 2, PriceType: "percent_of_total", Quantity: 1},
+	}, &months, calcOptions{})
+	// Обе процентные строки — от суммы непроцентных 2000, а не друг от друга
+	if out.Total != 2100 || out.Subtotals[percentOfTotal] != 100 {
+		t.Fatalf("total %v, percent subtotal %v; want 2100, 100", out.Total, out.Subtotals[percentOfTotal])
+	}
+	if out.LineItems[2].Cost != 60 || out.LineItems[3].Cost != 40 {
+		t.Fatalf("percent lines = %v, %v; want 60, 40", out.LineItems[2].Cost, out.LineItems[3].Cost)
+	}
+}
+
+func TestUsageAllowance(t *testing.T) {
+	one := 1
+	cases := []struct {
+		used              int
+		total, overageSum float64
+	}{
+		{used: 80, total: 80},
+		{used: 100, total: 100},
+		{used: 130, total: 100 + 30*2.5, overageSum: 75},
+	}
+	for _, tc := range cases {
+		item := serviceItem{ID: 1, Price: 1, PriceType: "monthly", Quantity: tc.used, IncludedUnits: 100, OveragePrice: 2.5}
+		out := calculate([]serviceItem{item}, &one, calcOptions{})
+		if out.Total != tc.total || out.OverageTotal != tc.overageSum {
+			t.Errorf("%d units: total %v, overage %v; want %v and %v", tc.used, out.Total, out.OverageTotal, tc.total, tc.overageSum)
+		}
+	}
+
+	useDeterministic(t)
+	usage := serviceItem{ID: 1, Price: 1, PriceType: "monthly", Quantity: 100, IncludedUnits: 100, OveragePrice: 2.5}
+	if result := computeResult(calcRequest{Services: []serviceItem{usage}}); result.OverageCost != nil {
+		t.Fatalf("at the allowance: overage_cost = %v, want absent", *result.OverageCost)
+	}
+	usage.Quantity = 101
+	if result := computeResult(calcRequest{Services: []serviceItem{usage}}); result.OverageCost == nil || *result.OverageCost != 30 {
+		t.Fatalf("over the allowance: overage_cost = %v, want 30 for 12 months", result.OverageCost)
+	}
+}
+
+func TestSameDayRange(t *testing.T) {
+	useDeterministic(t)
+	req := calcRequest{
+		StartDate: "2025-03-10",
+		EndDate:   "2025-03-10",
+		Services: []serviceItem{
+			{ID: 1, Price: 100, PriceType: "monthly", Quantity: 1},
+			{ID: 2, Price: 40, PriceType: "one_time", Quantity: 1},
+		},
+	}
+
+	result := computeResult(req)
+	if *result.TotalCost != 140 || months(result.DurationMonths) != 1 {
+		t.Fatalf("default: total %v, duration %d; want 140 for 1 month", *result.TotalCost, months(result.DurationMonths))
+	}
+
+	swap(t, &sameDayZeroDuration, true)
+	result = computeResult(req)
+	if *result.TotalCost != 40 || months(result.DurationMonths) != 0 {
+		t.Fatalf("SAME_DAY_ZERO_DURATION: total %v, duration %d; want 40 for 0 months", *result.TotalCost, months(result.DurationMonths))
+	}
+}
+
+func TestPriceTypeNormalized(t *testing.T) {
+	one := 1
+	for _, priceType := range []string{"Monthly", " MONTHLY ", "\tmonthly"} {
+		out := calculate([]serviceItem{{ID: 1, Price: 10, PriceType: priceType, Quantity: 1}}, &one, calcOptions{})
+		if out.Total != 10 || !out.Recurring || len(out.Warnings) != 0 {
+			t.Errorf("%q: total %v, recurring %t, warnings %q; want a monthly 10", priceType, out.Total, out.Recurring, out.Warnings)
+		}
+		if len(out.LineItems) != 1 || out.LineItems[0].PriceType != "monthly" {
+			t.Errorf("%q: line_items %+v, want price_type monthly", priceType, out.LineItems)
+		}
+	}
+
+	swap(t, &strictPriceTypes, true)
+	if err := validateService(serviceItem{ID: 1, Price: 10, PriceType: " One_Time ", Quantity: 1}); err != nil {
+		t.Fatalf("padded one_time with STRICT_PRICE_TYPES: %v", err)
+	}
+}
+
+func TestQuantityZeroPolicies(t *testing.T) {
+	one := 1
+	items := []serviceItem{
+		{ID: 1, Price: 10, PriceType: "monthly"},
+		{ID: 2, Price: 5, PriceType: "monthly", Quantity: 2},
+	}
+
+	swap(t, &quantityZeroPolicy, "default-to-1")
+	out := calculate(items, &one, calcOptions{})
+	if out.Total != 20 || !reflect.DeepEqual(out.Warnings, []string{"service 1: quantity 0 defaulted to 1"}) {
+		t.Errorf("default-to-1: total %v, warnings %q", out.Total, out.Warnings)
+	}
+	if err := validateService(items[0]); err != nil {
+		t.Errorf("default-to-1: %v", err)
+	}
+
+	quantityZeroPolicy = "treat-as-zero"
+	out = calculate(items, &one, calcOptions{})
+	if out.Total != 10 || len(out.Warnings) != 0 {
+		t.Errorf("treat-as-zero: total %v, warnings %q", out.Total, out.Warnings)
+	}
+
+	quantityZeroPolicy = "reject"
+	if err := validateService(items[0]); err == nil || err.Error() != "quantity must be positive" {
+		t.Errorf("reject: err = %v", err)
+	}
+	if err := validateService(items[1]); err != nil {
+		t.Errorf("reject, positive quantity: %v", err)
+	}
+}
+
+func TestAvgUnitPrice(t *testing.T) {
+	useDeterministic(t)
+	// 45 + 10 % = 49.5 на 3 единицы; процентная строка в количество не входит
+	result := computeResult(calcRequest{Services: []serviceItem{
+		{ID: 1, Price: 10, PriceType: "one_time", Quantity: 2},
+		{ID: 2, Price: 25, PriceType: "one_time", Quantity: 1},
+		{ID: 3, Price: 10, PriceType: "percent_of_total", Quantity: 1},
+	}})
+	if result.AvgUnitPrice == nil || *result.AvgUnitPrice != 16.5 {
+		t.Fatalf("avg_unit_price = %+v, want 16.5", result)
+	}
+
+	swap(t, &quantityZeroPolicy, "treat-as-zero")
+	result = computeResult(calcRequest{Services: []serviceItem{{ID: 1, Price: 10, PriceType: "one_time"}}})
+	if result.AvgUnitPrice != nil {
+		t.Fatalf("zero quantity: avg_unit_price = %v, want absent", *result.AvgUnitPrice)
+	}
+}
+
+// counterValue читает счётчик из реестра по умолчанию.
+func counterValue(t *testing.T, name string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range families {
+		if mf.GetName() == name {
+			return mf.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestAllZeroQuantitiesWarn(t *testing.T) {
+	useDeterministic(t)
+	before := counterValue(t, "asynccalc_quantity_defaulted_requests_total")
+	result := computeResult(calcRequest{Services: []serviceItem{
+		{ID: 1, Price: 10, PriceType: "monthly"},
+		{ID: 2, Price: 5, PriceType: "one_time"},
+	}})
+	want := []string{
+		"service 1: quantity 0 defaulted to 1",
+		"service 2: quantity 0 defaulted to 1",
+		"quantity defaulted to 1 for 2 of 2 services, check the request",
+	}
+	if !reflect.DeepEqual(result.Warnings, want) {
+		t.Fatalf("warnings = %q, want %q", result.Warnings, want)
+	}
+	if got := counterValue(t, "asynccalc_quantity_defaulted_requests_total") - before; got != 1 {
+		t.Fatalf("quantity_defaulted_requests grew by %v, want 1", got)
+	}
+
+	// Одна строка из двух — в пределах QUANTITY_DEFAULT_WARN_FRACTION
+	result = computeResult(calcRequest{Services: []serviceItem{
+		{ID: 1, Price: 10, PriceType: "monthly"},
+		{ID: 2, Price: 5, PriceType: "one_time", Quantity: 1},
+	}})
+	if len(result.Warnings) != 1 {
+		t.Fatalf("one of two defaulted: warnings %q", result.Warnings)
+	}
+}
+
+func TestPartialMonthRounding(t *testing.T) {
+	useDeterministic(t)
+	cases := []struct {
+		start, end string
+		want       map[string]int
+	}{
+		// Ровно полтора месяца: февраль — 28 дней, остаток 14 дней
+		{"2025-01-01", "2025-02-15", map[string]int{"": 2, "day-compare": 2, "ceil-any-partial": 2, "round-half": 2}},
+		// Чуть меньше полутора: round-half округляет вниз
+		{"2025-01-01", "2025-02-14", map[string]int{"": 2, "day-compare": 2, "ceil-any-partial": 2, "round-half": 1}},
+		// 29 дней с конца января: day-compare считает по календарным месяцам
+		{"2025-01-31", "2025-03-01", map[string]int{"": 2, "day-compare": 2, "ceil-any-partial": 1, "round-half": 1}},
+		// Тот же день месяца — ровно месяц при любой политике
+		{"2025-01-15", "2025-02-15", map[string]int{"": 1, "day-compare": 1, "ceil-any-partial": 1, "round-half": 1}},
+	}
+	for _, tc := range cases {
+		for policy, want := range tc.want {
+			result := computeResult(calcRequest{
+				StartDate:            tc.start,
+				EndDate:              tc.end,
+				PartialMonthRounding: policy,
+				Services:             []serviceItem{{ID: 1, Price: 100, PriceType: "monthly", Quantity: 1}},
+			})
+			if months(result.DurationMonths) != want || *result.TotalCost != float64(100*want) {
+				t.Errorf("%s..%s, %q: %d months, total %v; want %d", tc.start, tc.end, policy, months(result.DurationMonths), *result.TotalCost, want)
+			}
+		}
+	}
+}
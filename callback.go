@@ -0,0 +1,599 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// callbackBudget ограничивает общее число попыток отправки колбэков в минуту
+// для всех заявок сразу. Инициализируется в main.
+var callbackBudget *retryBudget
+
+// retryBudget — глобальный бюджет попыток в фиксированном окне времени.
+// При limit <= 0 бюджет не ограничен.
+type retryBudget struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	start  time.Time
+	used   int
+}
+
+func newRetryBudget(limit int, window time.Duration) *retryBudget {
+	return &retryBudget{limit: limit, window: window, start: clock.Now()}
+}
+
+// wait занимает одну попытку из бюджета, а если бюджет текущего окна исчерпан —
+// откладывает попытку до начала следующего окна.
+func (b *retryBudget) wait() {
+	if b == nil || b.limit <= 0 {
+		return
+	}
+	for {
+		b.mu.Lock()
+		now := clock.Now()
+		if now.Sub(b.start) >= b.window {
+			b.start = now
+			b.used = 0
+		}
+		if b.used < b.limit {
+			b.used++
+			b.mu.Unlock()
+			return
+		}
+		sleep := b.window - now.Sub(b.start)
+		b.mu.Unlock()
+		log.Printf("callback retry budget exhausted, deferring for %s", sleep)
+		clock.Sleep(sleep)
+	}
+}
+
+// CallbackSender выполняет одну попытку доставки уже сериализованного
+// колбэка (JSON) получателю. Сериализация, повторы и бюджет попыток —
+// забота sendCallback.
+type CallbackSender interface {
+	Send(ctx context.Context, url string, body []byte) error
+}
+
+// callbackSender — транспорт колбэков. В main выбирается по CALLBACK_TRANSPORT
+// (http по умолчанию, amqp) или заменяется на sandbox; в тестах — подделкой.
+var callbackSender CallbackSender = newHTTPCallbackSender()
+
+// sendCallback отправляет результат с повторами и экспоненциальной задержкой.
+// Если все попытки на url не удались, а fallbackURL задан, результат так же
+// отправляется на него. В оба URL подставляются {id} и {status} результата.
+// Возвращает URL, на который колбэк доставлен, или пустую строку.
+func sendCallback(ctx context.Context, url, fallbackURL string, payload calcResult) string {
+	ctx, span := tracer.Start(ctx, "sendCallback")
+	defer span.End()
+
+	body, err := fitCallbackPayload(payload, getEnvInt("CALLBACK_MAX_PAYLOAD_BYTES", 0))
+	if err != nil {
+		log.Print(err)
+		return ""
+	}
+	if fallbackURL != "" {
+		fallbackURL = expandCallbackURL(fallbackURL, payload.CalculationID, payload.Status)
+	}
+	return deliverCallback(ctx, expandCallbackURL(url, payload.CalculationID, payload.Status), fallbackURL, body)
+}
+
+// optionalResultFields — необязательные поля результата в порядке, в
+// котором они отбрасываются, когда колбэк превышает допустимый размер.
+// drop возвращает false, если поле и так пустое.
+var optionalResultFields = []struct {
+	name string
+	drop func(*calcResult) bool
+}{
+	{"request", func(r *calcResult) bool { ok := r.Request != nil; r.Request = nil; return ok }},
+	{"line_items", func(r *calcResult) bool { ok := r.LineItems != nil; r.LineItems = nil; return ok }},
+	{"yearly_totals", func(r *calcResult) bool { ok := r.YearlyTotals != nil; r.YearlyTotals = nil; return ok }},
+	{"subtotals", func(r *calcResult) bool { ok := r.Subtotals != nil; r.Subtotals = nil; return ok }},
+	{"warnings", func(r *calcResult) bool { ok := r.Warnings != nil; r.Warnings = nil; return ok }},
+	{"skipped", func(r *calcResult) bool { ok := r.Skipped != nil; r.Skipped = nil; return ok }},
+	{"metadata", func(r *calcResult) bool { ok := r.Metadata != nil; r.Metadata = nil; return ok }},
+	{"converted_totals", func(r *calcResult) bool {
+		ok := r.ConvertedTotals != nil || r.ConversionErrors != nil
+		r.ConvertedTotals, r.ConversionErrors = nil, nil
+		return ok
+	}},
+}
+
+// fitCallbackPayload сериализует результат, укладываясь в maxBytes
+// (CALLBACK_MAX_PAYLOAD_BYTES, 0 — без ограничения): необязательные поля
+// отбрасываются по одному, а если и этого мало — уходит минимальный
+// результат. Отброшенное перечисляется в note.
+func fitCallbackPayload(payload calcResult, maxBytes int) ([]byte, error) {
+	body, err := marshalCallback(payload)
+	if err != nil || maxBytes <= 0 || len(body) <= maxBytes {
+		return body, err
+	}
+	size := len(body)
+	note := payload.Note
+	var dropped []string
+	for _, field := range optionalResultFields {
+		if !field.drop(&payload) {
+			continue
+		}
+		dropped = append(dropped, field.name)
+		payload.Note = appendNote(note, "payload trimmed, dropped: "+strings.Join(dropped, ", "))
+		if body, err = marshalCallback(payload); err != nil || len(body) <= maxBytes {
+			log.Printf("callback for calculation %d is %d bytes, over %d: dropped %s", payload.CalculationID, size, maxBytes, strings.Join(dropped, ", "))
+			return body, err
+		}
+	}
+	log.Printf("callback for calculation %d is %d bytes, over %d: sending minimal result", payload.CalculationID, size, maxBytes)
+	return marshalCallback(calcResult{
+		CalculationID:  payload.CalculationID,
+		Status:         payload.Status,
+		TotalCost:      payload.TotalCost,
+		Currency:       payload.Currency,
+		DurationMonths: payload.DurationMonths,
+		Note:           "payload too large, minimal result sent",
+	})
+}
+
+func appendNote(note, extra string) string {
+	if note == "" {
+		return extra
+	}
+	return note + "; " + extra
+}
+
+// sendBatchCallback отправляет несколько результатов одним колбэком-массивом.
+func sendBatchCallback(ctx context.Context, url string, payloads []calcResult) {
+	ctx, span := tracer.Start(ctx, "sendBatchCallback")
+	defer span.End()
+
+	body, err := marshalCallback(payloads)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	deliverCallback(ctx, url, "", body)
+}
+
+// deliverCallback доставляет тело колбэка с повторами, а после их
+// исчерпания — на fallbackURL, если он задан. Остановка сервиса доставку не
+// прерывает: из ctx берётся только контекст трассировки. Возвращает URL,
+// на который тело доставлено, или пустую строку.
+func deliverCallback(ctx context.Context, url, fallbackURL string, body []byte) string {
+	return runDelivery(context.WithoutCancel(ctx), retryEntry{
+		ID:          pendingRetries.newID(),
+		URL:         url,
+		FallbackURL: fallbackURL,
+		Body:        body,
+		Backoff:     getEnvDuration("CALLBACK_RETRY_DELAY", time.Second),
+		Gzip:        callbackGzip(ctx),
+		Limits:      callbackLimitsFrom(ctx),
+	})
+}
+
+// runDelivery выполняет попытки доставки начиная с e.Attempt. После каждой
+// неудачи запись сохраняется в pendingRetries, чтобы после перезапуска
+// resumeRetries продолжил с того же места расписания. Когда попытки на
+// e.URL исчерпаны, доставка начинается заново на e.FallbackURL.
+func runDelivery(ctx context.Context, e retryEntry) string {
+	if e.Gzip {
+		ctx = withCallbackGzip(ctx)
+	}
+	maxRetries := getEnvInt("CALLBACK_MAX_RETRIES", 3)
+	if e.Limits.MaxRetries != nil {
+		maxRetries = *e.Limits.MaxRetries
+	}
+	// Возобновлённая после перезапуска запись уже ждёт повтора
+	retrying := e.Attempt > 0
+	if retrying {
+		inflight.retrying.Add(1)
+	}
+	defer func() {
+		if retrying {
+			inflight.retrying.Add(-1)
+		}
+	}()
+	for {
+		if wait := e.NextAt.Sub(clock.Now()); wait > 0 {
+			clock.Sleep(wait)
+		}
+		callbackBudget.wait()
+		err := sendAttempt(ctx, e)
+		if err == nil {
+			pendingRetries.remove(e.ID)
+			return e.URL
+		}
+		e.Attempt++
+		if !retryableCallbackError(err, getEnv("CALLBACK_RETRY_CONDITIONS", "all")) {
+			log.Printf("callback attempt %d failed: %v, not retrying", e.Attempt, err)
+			pendingRetries.remove(e.ID)
+			return deliverFallback(ctx, e)
+		}
+		if e.Attempt > maxRetries {
+			log.Printf("callback failed after %d attempts: %v", e.Attempt, err)
+			pendingRetries.remove(e.ID)
+			return deliverFallback(ctx, e)
+		}
+		log.Printf("callback attempt %d failed: %v, retrying in %s", e.Attempt, err, e.Backoff)
+		if !retrying {
+			retrying = true
+			inflight.retrying.Add(1)
+		}
+		e.NextAt = clock.Now().Add(e.Backoff)
+		e.Backoff *= 2
+		pendingRetries.save(e)
+	}
+}
+
+// deliverFallback переключает неудавшуюся доставку на fallback_callback_url.
+func deliverFallback(ctx context.Context, failed retryEntry) string {
+	if failed.FallbackURL == "" {
+		return ""
+	}
+	log.Printf("callback to %s failed, trying fallback %s", redactURL(failed.URL), redactURL(failed.FallbackURL))
+	return runDelivery(ctx, retryEntry{
+		ID:      pendingRetries.newID(),
+		URL:     failed.FallbackURL,
+		Body:    failed.Body,
+		Backoff: getEnvDuration("CALLBACK_RETRY_DELAY", time.Second),
+		Gzip:    failed.Gzip,
+		Limits:  failed.Limits,
+	})
+}
+
+// sendAttempt делает одну попытку доставки, ограниченную таймаутом заявки,
+// если он задан.
+func sendAttempt(ctx context.Context, e retryEntry) error {
+	if e.Limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.Limits.Timeout)
+		defer cancel()
+	}
+	return callbackSender.Send(ctx, e.URL, e.Body)
+}
+
+// callbackStatusError — получатель ответил кодом вне CALLBACK_SUCCESS_CODES.
+type callbackStatusError struct {
+	Code int
+	// RetryAfter — в ответе был заголовок Retry-After.
+	RetryAfter bool
+}
+
+func (e *callbackStatusError) Error() string {
+	return fmt.Sprintf("callback responded with status %d", e.Code)
+}
+
+// retryableCallbackError решает, повторять ли доставку после err, по
+// CALLBACK_RETRY_CONDITIONS:
+//   - all (по умолчанию) — повторять после любой ошибки;
+//   - safe — только если получатель точно не обработал колбэк: ошибка
+//     соединения, 429, 503 или ответ с Retry-After. Обычный 500 мог прийти
+//     уже после обработки, и повтор задублировал бы доставку.
+func retryableCallbackError(err error, conditions string) bool {
+	if conditions != "safe" {
+		return true
+	}
+	var statusErr *callbackStatusError
+	if !errors.As(err, &statusErr) {
+		return true
+	}
+	return statusErr.RetryAfter || statusErr.Code == http.StatusTooManyRequests || statusErr.Code == http.StatusServiceUnavailable
+}
+
+// resumeRetries продолжает повторы, сохранённые до перезапуска.
+func resumeRetries() {
+	if pendingRetries == nil {
+		return
+	}
+	for _, e := range pendingRetries.list() {
+		log.Printf("resuming callback retry to %s after %d attempts", redactURL(e.URL), e.Attempt)
+		go runDelivery(context.Background(), e)
+	}
+}
+
+// callbackGzipKey — ключ контекста: получатель колбэка принимает gzip.
+type callbackGzipKey struct{}
+
+// withCallbackGzip отмечает, что получатель принимает тело колбэка в gzip
+// (callback_accepts_gzip). Сжатие — забота HTTP-транспорта: для остальных
+// транспортов, sandbox и CALLBACK_RETRY_FILE тело остаётся обычным JSON.
+func withCallbackGzip(ctx context.Context) context.Context {
+	return context.WithValue(ctx, callbackGzipKey{}, true)
+}
+
+func callbackGzip(ctx context.Context) bool {
+	on, _ := ctx.Value(callbackGzipKey{}).(bool)
+	return on
+}
+
+// callbackLimits — таймаут попытки и число повторов доставки одной заявки
+// (callback_timeout_ms, callback_max_retries) вместо глобальных настроек.
+type callbackLimits struct {
+	// Timeout — таймаут одной попытки; 0 — таймаут транспорта.
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// MaxRetries — число повторов; nil — CALLBACK_MAX_RETRIES.
+	MaxRetries *int `json:"max_retries,omitempty"`
+}
+
+// callbackLimitsKey — ключ контекста для callbackLimits.
+type callbackLimitsKey struct{}
+
+func withCallbackLimits(ctx context.Context, limits callbackLimits) context.Context {
+	return context.WithValue(ctx, callbackLimitsKey{}, limits)
+}
+
+func callbackLimitsFrom(ctx context.Context) callbackLimits {
+	limits, _ := ctx.Value(callbackLimitsKey{}).(callbackLimits)
+	return limits
+}
+
+// gzipBody сжимает тело колбэка.
+func gzipBody(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(body); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sendHeartbeat отправляет промежуточный колбэк со статусом pending.
+// Доставка без повторов: следующий heartbeat или итог всё равно придёт.
+func sendHeartbeat(req calcRequest) {
+	sendInterimCallback(req, "pending", "calculation in progress")
+}
+
+// sendAccepted отправляет однократный колбэк accepted при приёме заявки
+// (accepted_callback). Как и heartbeat — без повторов.
+func sendAccepted(req calcRequest) {
+	sendInterimCallback(req, "accepted", "calculation accepted")
+}
+
+// sendInterimCallback отправляет промежуточный колбэк без итога.
+func sendInterimCallback(req calcRequest, status, note string) {
+	payload := calcResult{
+		CalculationID: req.CalculationID,
+		Status:        status,
+		Note:          note,
+		Metadata:      req.Metadata,
+	}
+	body, err := marshalCallback(payload)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	callbackBudget.wait()
+	target := expandCallbackURL(req.CallbackURL, payload.CalculationID, payload.Status)
+	if err := callbackSender.Send(context.Background(), target, body); err != nil {
+		log.Printf("%s callback failed: %v", status, err)
+	}
+}
+
+// callbackTimeout — таймаут попытки доставки колбэка, если заявка не задала
+// свой (callback_timeout_ms).
+const callbackTimeout = 10 * time.Second
+
+// httpCallbackSender отправляет результат POST-запросом с JSON-телом.
+type httpCallbackSender struct {
+	client *http.Client
+	// timeout — таймаут попытки, если у ctx нет своего срока.
+	timeout time.Duration
+	// successCodes — коды ответа, при которых доставка считается успешной.
+	successCodes statusCodeSet
+	// contentType — заголовок Content-Type колбэка (CALLBACK_CONTENT_TYPE).
+	contentType string
+}
+
+func newHTTPCallbackSender() *httpCallbackSender {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = callbackProxy(getEnv("CALLBACK_PROXY_URL", ""))
+
+	// Таймаут — через контекст попытки: его может переопределить заявка
+	// (callback_timeout_ms), а client.Timeout ограничил бы его сверху
+	client := &http.Client{
+		Transport:     transport,
+		CheckRedirect: redirectPolicy(getEnv("CALLBACK_REDIRECT_POLICY", "none")),
+	}
+	codes, err := parseStatusCodes(getEnv("CALLBACK_SUCCESS_CODES", "200-299"))
+	if err != nil {
+		log.Printf("invalid CALLBACK_SUCCESS_CODES: %v, using 200-299", err)
+		codes = statusCodeSet{{200, 299}}
+	}
+	return &httpCallbackSender{client: client, timeout: callbackTimeout, successCodes: codes, contentType: callbackContentType()}
+}
+
+// callbackContentType читает CALLBACK_CONTENT_TYPE, например
+// "application/json; charset=utf-8" или vendor-тип. Значение, не похожее
+// на media type, заменяется на application/json.
+func callbackContentType() string {
+	value := getEnv("CALLBACK_CONTENT_TYPE", "application/json")
+	mediaType, _, err := mime.ParseMediaType(value)
+	if err != nil || !strings.Contains(mediaType, "/") {
+		log.Printf("invalid CALLBACK_CONTENT_TYPE=%q, using application/json", value)
+		return "application/json"
+	}
+	return value
+}
+
+// statusCodeSet — набор диапазонов HTTP-кодов (включительно).
+type statusCodeSet [][2]int
+
+func (s statusCodeSet) contains(code int) bool {
+	for _, r := range s {
+		if code >= r[0] && code <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// parseStatusCodes разбирает список вида "200-299,302".
+func parseStatusCodes(value string) (statusCodeSet, error) {
+	var set statusCodeSet
+	for _, item := range splitList(value) {
+		lo, hi, isRange := strings.Cut(item, "-")
+		if !isRange {
+			hi = lo
+		}
+		from, err1 := strconv.Atoi(strings.TrimSpace(lo))
+		to, err2 := strconv.Atoi(strings.TrimSpace(hi))
+		if err1 != nil || err2 != nil || from < 100 || to > 599 || from > to {
+			return nil, fmt.Errorf("invalid status code range %q", item)
+		}
+		set = append(set, [2]int{from, to})
+	}
+	if len(set) == 0 {
+		return nil, errors.New("no status codes")
+	}
+	return set, nil
+}
+
+// callbackProxy возвращает прокси для колбэков: явный CALLBACK_PROXY_URL или,
+// если он не задан, HTTPS_PROXY/HTTP_PROXY/NO_PROXY из окружения.
+func callbackProxy(proxyURL string) func(*http.Request) (*url.URL, error) {
+	if proxyURL == "" {
+		return http.ProxyFromEnvironment
+	}
+	u, err := url.Parse(proxyURL)
+	if err != nil || u.Host == "" {
+		log.Printf("invalid CALLBACK_PROXY_URL=%q, using environment proxy settings", proxyURL)
+		return http.ProxyFromEnvironment
+	}
+	return http.ProxyURL(u)
+}
+
+// redirectPolicy определяет, как клиент колбэков обрабатывает 3xx:
+//   - none (по умолчанию) — редирект не выполняется, ответ 3xx считается
+//     ошибкой и уходит на повтор;
+//   - strip-auth — редирект выполняется, но при смене хоста X-ASYNC-TOKEN
+//     не передаётся.
+func redirectPolicy(policy string) func(*http.Request, []*http.Request) error {
+	switch policy {
+	case "strip-auth":
+		return func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			if req.URL.Host != via[0].URL.Host {
+				req.Header.Del("X-ASYNC-TOKEN")
+			}
+			return nil
+		}
+	case "none":
+	default:
+		log.Printf("unknown CALLBACK_REDIRECT_POLICY=%q, using none", policy)
+	}
+	return func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+}
+
+// marshalCallback сериализует результат (или их массив) одинаково для всех
+// транспортов.
+func marshalCallback(payload any) ([]byte, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("callback marshal error: %w", err)
+	}
+	return body, nil
+}
+
+// Send отправляет body как есть, а если получатель принимает gzip — сжатым,
+// с Content-Encoding: gzip. Сжимается итоговый JSON, уже урезанный до
+// CALLBACK_MAX_PAYLOAD_BYTES; X-ASYNC-TOKEN от тела не зависит.
+func (s *httpCallbackSender) Send(ctx context.Context, url string, body []byte) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	gzipped := callbackGzip(ctx)
+	if gzipped {
+		var err error
+		if body, err = gzipBody(body); err != nil {
+			return fmt.Errorf("callback gzip error: %w", err)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("callback build error: %w", err)
+	}
+
+	req.Header.Set("Content-Type", s.contentType)
+	if gzipped {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	req.Header.Set("User-Agent", getEnv("CALLBACK_USER_AGENT", serviceName+"/"+serviceVersion))
+	req.Header.Set("X-ASYNC-TOKEN", getEnv("ASYNC_CALLBACK_TOKEN", "async-secret"))
+	injectTrace(ctx, req.Header)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("callback send error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if !s.successCodes.contains(resp.StatusCode) {
+		return &callbackStatusError{Code: resp.StatusCode, RetryAfter: resp.Header.Get("Retry-After") != ""}
+	}
+	return nil
+}
+
+// hostLimitedSender ограничивает число одновременных доставок на один хост
+// получателя, чтобы медленный получатель не занимал все отправки.
+type hostLimitedSender struct {
+	next    CallbackSender
+	perHost int
+
+	mu   sync.Mutex
+	sems map[string]chan struct{}
+}
+
+func newHostLimitedSender(next CallbackSender, perHost int) *hostLimitedSender {
+	return &hostLimitedSender{next: next, perHost: perHost, sems: map[string]chan struct{}{}}
+}
+
+func (s *hostLimitedSender) Send(ctx context.Context, callbackURL string, body []byte) error {
+	sem := s.semaphore(callbackHost(callbackURL))
+	select {
+	case sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-sem }()
+	return s.next.Send(ctx, callbackURL, body)
+}
+
+func (s *hostLimitedSender) semaphore(host string) chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sem, ok := s.sems[host]
+	if !ok {
+		sem = make(chan struct{}, s.perHost)
+		s.sems[host] = sem
+	}
+	return sem
+}
+
+// callbackHost — ключ ограничения: хост URL (с портом) либо сам URL,
+// если его не разобрать.
+func callbackHost(callbackURL string) string {
+	u, err := url.Parse(callbackURL)
+	if err != nil || u.Host == "" {
+		return callbackURL
+	}
+	return u.Host
+}
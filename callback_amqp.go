@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// amqpCallbackSender публикует результат в очередь RabbitMQ вместо POST.
+// Адрес колбэка передаётся в заголовке callback_url, чтобы потребитель мог
+// маршрутизировать результат так же, как при HTTP-доставке.
+type amqpCallbackSender struct {
+	url        string
+	exchange   string
+	routingKey string
+	// contentType — тип тела сообщения (CALLBACK_CONTENT_TYPE).
+	contentType string
+
+	mu   sync.Mutex
+	conn *amqp.Connection
+	ch   *amqp.Channel
+}
+
+func newAMQPCallbackSender(url, exchange, routingKey string) *amqpCallbackSender {
+	return &amqpCallbackSender{url: url, exchange: exchange, routingKey: routingKey, contentType: callbackContentType()}
+}
+
+func (s *amqpCallbackSender) Send(ctx context.Context, callbackURL string, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch, err := s.channel()
+	if err != nil {
+		return fmt.Errorf("amqp connect error: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	err = ch.PublishWithContext(ctx, s.exchange, s.routingKey, false, false, amqp.Publishing{
+		ContentType:  s.contentType,
+		DeliveryMode: amqp.Persistent,
+		Timestamp:    now(),
+		Headers:      amqp.Table{"callback_url": callbackURL},
+		Body:         body,
+	})
+	if err != nil {
+		// Соединение могло оборваться — переподключимся при следующей попытке
+		s.close()
+		return fmt.Errorf("amqp publish error: %w", err)
+	}
+	return nil
+}
+
+// channel возвращает открытый канал, при необходимости переподключаясь.
+// Вызывается под s.mu.
+func (s *amqpCallbackSender) channel() (*amqp.Channel, error) {
+	if s.ch != nil && !s.ch.IsClosed() {
+		return s.ch, nil
+	}
+	s.close()
+
+	conn, err := amqp.Dial(s.url)
+	if err != nil {
+		return nil, err
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	s.conn, s.ch = conn, ch
+	return ch, nil
+}
+
+func (s *amqpCallbackSender) close() {
+	if s.ch != nil {
+		s.ch.Close()
+		s.ch = nil
+	}
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSender — CallbackSender для тестов: запоминает колбэки, а fail, если
+// задана, решает исход n-й (с 1) попытки на url.
+type fakeSender struct {
+	mu    sync.Mutex
+	sent  []capturedCallback
+	tries map[string]int
+	fail  func(url string, n int) error
+}
+
+// useFakeSender подменяет callbackSender на время теста.
+func useFakeSender(t *testing.T) *fakeSender {
+	t.Helper()
+	fs := &fakeSender{tries: map[string]int{}}
+	prev := callbackSender
+	callbackSender = fs
+	t.Cleanup(func() { callbackSender = prev })
+	return fs
+}
+
+func (s *fakeSender) Send(_ context.Context, url string, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tries[url]++
+	if s.fail != nil {
+		if err := s.fail(url, s.tries[url]); err != nil {
+			return err
+		}
+	}
+	s.sent = append(s.sent, capturedCallback{URL: url, Payload: append(json.RawMessage(nil), body...)})
+	return nil
+}
+
+// delivered — успешно доставленные колбэки в порядке доставки.
+func (s *fakeSender) delivered() []capturedCallback {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]capturedCallback(nil), s.sent...)
+}
+
+// attempts — число попыток на url, включая неудачные.
+func (s *fakeSender) attempts(url string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tries[url]
+}
+
+// decodeResult разбирает тело колбэка с одним результатом.
+func decodeResult(t *testing.T, cb capturedCallback) calcResult {
+	t.Helper()
+	var result calcResult
+	if err := json.Unmarshal(cb.Payload, &result); err != nil {
+		t.Fatalf("callback body %s: %v", cb.Payload, err)
+	}
+	return result
+}
+
+func TestSendCallbackDeliversPayload(t *testing.T) {
+	fs := useFakeSender(t)
+	total := 120.0
+
+	to := sendCallback(context.Background(), "http://receiver/{id}/{status}", "", calcResult{
+		CalculationID: 42,
+		Status:        "success",
+		TotalCost:     &total,
+	})
+	if to != "http://receiver/42/success" {
+		t.Fatalf("delivered to %q", to)
+	}
+	sent := fs.delivered()
+	if len(sent) != 1 || sent[0].URL != "http://receiver/42/success" {
+		t.Fatalf("sent = %+v", sent)
+	}
+	got := decodeResult(t, sent[0])
+	if got.CalculationID != 42 || got.TotalCost == nil || *got.TotalCost != 120 {
+		t.Fatalf("payload = %+v", got)
+	}
+}
+
+func TestSendCallbackRetriesWithBackoff(t *testing.T) {
+	fc := useFakeClock(t)
+	fs := useFakeSender(t)
+	fs.fail = func(_ string, n int) error {
+		if n < 3 {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+
+	to := sendCallback(context.Background(), "http://receiver", "", calcResult{CalculationID: 1, Status: "success"})
+	if to != "http://receiver" {
+		t.Fatalf("delivered to %q", to)
+	}
+	if n := fs.attempts("http://receiver"); n != 3 {
+		t.Fatalf("attempts = %d, want 3", n)
+	}
+	if got, want := fc.sleeps(), []time.Duration{time.Second, 2 * time.Second}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("backoff = %v, want %v", got, want)
+	}
+}
+
+func TestSendCallbackFallsBackAfterRetries(t *testing.T) {
+	useFakeClock(t)
+	fs := useFakeSender(t)
+	t.Setenv("CALLBACK_MAX_RETRIES", "2")
+	fs.fail = func(url string, _ int) error {
+		if url == "http://primary" {
+			return &callbackStatusError{Code: 500}
+		}
+		return nil
+	}
+
+	to := sendCallback(context.Background(), "http://primary", "http://fallback", calcResult{CalculationID: 1, Status: "success"})
+	if to != "http://fallback" {
+		t.Fatalf("delivered to %q, want fallback", to)
+	}
+	if n := fs.attempts("http://primary"); n != 3 {
+		t.Fatalf("primary attempts = %d, want 3", n)
+	}
+	if sent := fs.delivered(); len(sent) != 1 || sent[0].URL != "http://fallback" {
+		t.Fatalf("sent = %+v", sent)
+	}
+}
+
+func TestRetryBudgetUnderMassFailure(t *testing.T) {
+	fc := useFakeClock(t)
+	fs := useFakeSender(t)
+	t.Setenv("CALLBACK_MAX_RETRIES", "4")
+	prev := callbackBudget
+	callbackBudget = newRetryBudget(3, time.Minute)
+	t.Cleanup(func() { callbackBudget = prev })
+
+	start := fc.Now()
+	perMinute := map[int]int{}
+	fs.fail = func(string, int) error {
+		perMinute[int(clock.Now().Sub(start)/time.Minute)]++
+		return errors.New("receiver is down")
+	}
+
+	// Получатель лежит: у каждой из 4 заявок 5 неудачных попыток
+	for id := 1; id <= 4; id++ {
+		if to := sendCallback(context.Background(), "http://receiver", "", calcResult{CalculationID: id, Status: "success"}); to != "" {
+			t.Fatalf("delivered to %q while receiver is down", to)
+		}
+	}
+	if n := fs.attempts("http://receiver"); n != 20 {
+		t.Fatalf("attempts = %d, want 20", n)
+	}
+	for minute, n := range perMinute {
+		if n > 3 {
+			t.Fatalf("minute %d: %d attempts, budget is 3", minute, n)
+		}
+	}
+	// 20 попыток по 3 в минуту — не меньше 7 окон
+	if elapsed := fc.Now().Sub(start); elapsed < 6*time.Minute {
+		t.Fatalf("attempts spread over %s, want at least 6m", elapsed)
+	}
+}
+
+func TestCallbackRedirectPolicy(t *testing.T) {
+	var gotToken, gotBody string
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotToken, gotBody = r.Header.Get("X-ASYNC-TOKEN"), string(body)
+	}))
+	defer target.Close()
+	// 307 сохраняет метод и тело; у второго сервера другой порт, т.е. хост
+	redirect := httptest.NewServer(http.RedirectHandler(target.URL+"/moved", http.StatusTemporaryRedirect))
+	defer redirect.Close()
+
+	t.Setenv("CALLBACK_REDIRECT_POLICY", "none")
+	err := newHTTPCallbackSender().Send(context.Background(), redirect.URL, []byte(`{"status":"success"}`))
+	var statusErr *callbackStatusError
+	if !errors.As(err, &statusErr) || statusErr.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("none: err = %v, want status 307 error", err)
+	}
+	if gotBody != "" {
+		t.Fatalf("none: redirect was followed")
+	}
+
+	t.Setenv("CALLBACK_REDIRECT_POLICY", "strip-auth")
+	if err := newHTTPCallbackSender().Send(context.Background(), redirect.URL, []byte(`{"status":"success"}`)); err != nil {
+		t.Fatalf("strip-auth: %v", err)
+	}
+	if gotBody != `{"status":"success"}` {
+		t.Fatalf("strip-auth: target got body %q", gotBody)
+	}
+	if gotToken != "" {
+		t.Fatalf("strip-auth: X-ASYNC-TOKEN %q leaked to another host", gotToken)
+	}
+}
+
+func TestCallbackProxyIsUsed(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Через прокси приходит абсолютный URL получателя
+		proxied = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	t.Setenv("CALLBACK_PROXY_URL", proxy.URL)
+	if err := newHTTPCallbackSender().Send(context.Background(), "http://receiver.invalid/callback", []byte(`{}`)); err != nil {
+		t.Fatalf("send through proxy: %v", err)
+	}
+	if proxied != "http://receiver.invalid/callback" {
+		t.Fatalf("proxy got %q, want the callback URL", proxied)
+	}
+}
+
+func TestCallbackSuccessCodes(t *testing.T) {
+	code := http.StatusOK
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+	}))
+	defer receiver.Close()
+
+	t.Setenv("CALLBACK_SUCCESS_CODES", "202, 409")
+	sender := newHTTPCallbackSender()
+	for _, c := range []int{http.StatusAccepted, http.StatusConflict} {
+		code = c
+		if err := sender.Send(context.Background(), receiver.URL, []byte(`{}`)); err != nil {
+			t.Errorf("status %d: %v, want success", c, err)
+		}
+	}
+	code = http.StatusOK
+	var statusErr *callbackStatusError
+	if err := sender.Send(context.Background(), receiver.URL, []byte(`{}`)); !errors.As(err, &statusErr) || statusErr.Code != 200 {
+		t.Errorf("status 200: err = %v, want a status error", err)
+	}
+
+	for _, value := range []string{"", "abc", "99", "300-200", "200-600"} {
+		if _, err := parseStatusCodes(value); err == nil {
+			t.Errorf("parseStatusCodes(%q) succeeded", value)
+		}
+	}
+}
+
+// captureHeaders — получатель, запоминающий заголовки последнего колбэка.
+func captureHeaders(t *testing.T) (*httptest.Server, *http.Header) {
+	t.Helper()
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &got
+}
+
+func TestCallbackUserAgent(t *testing.T) {
+	srv, got := captureHeaders(t)
+
+	if err := newHTTPCallbackSender().Send(context.Background(), srv.URL, []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	if ua := got.Get("User-Agent"); ua != serviceName+"/"+serviceVersion {
+		t.Fatalf("default User-Agent = %q", ua)
+	}
+
+	t.Setenv("CALLBACK_USER_AGENT", "billing-calc/2.1 (+ops@example.com)")
+	if err := newHTTPCallbackSender().Send(context.Background(), srv.URL, []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	if ua := got.Get("User-Agent"); ua != "billing-calc/2.1 (+ops@example.com)" {
+		t.Fatalf("CALLBACK_USER_AGENT: User-Agent = %q", ua)
+	}
+}
+
+// senderFunc позволяет использовать функцию как CallbackSender.
+type senderFunc func(ctx context.Context, url string, body []byte) error
+
+func (f senderFunc) Send(ctx context.Context, url string, body []byte) error {
+	return f(ctx, url, body)
+}
+
+func TestHostLimitedSenderIsolatesHosts(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	sender := newHostLimitedSender(senderFunc(func(_ context.Context, url string, _ []byte) error {
+		if strings.HasPrefix(url, "http://slow") {
+			close(started)
+			<-release
+		}
+		return nil
+	}), 1)
+
+	go sender.Send(context.Background(), "http://slow/a", nil)
+	<-started
+
+	// Медленный хост занял свой единственный слот, но не чужой
+	if err := sender.Send(context.Background(), "http://fast/b", nil); err != nil {
+		t.Fatalf("fast host: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := sender.Send(ctx, "http://slow/c", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("second delivery to the slow host: err = %v, want it to wait for the slot", err)
+	}
+	close(release)
+}
+
+func TestCallbackContentType(t *testing.T) {
+	srv, got := captureHeaders(t)
+	for _, tc := range []struct{ env, want string }{
+		{"", "application/json"},
+		{"application/json; charset=utf-8", "application/json; charset=utf-8"},
+		{"application/vnd.billing.result+json", "application/vnd.billing.result+json"},
+		{"not a media type", "application/json"},
+	} {
+		t.Setenv("CALLBACK_CONTENT_TYPE", tc.env)
+		if err := newHTTPCallbackSender().Send(context.Background(), srv.URL, []byte(`{}`)); err != nil {
+			t.Fatal(err)
+		}
+		if ct := got.Get("Content-Type"); ct != tc.want {
+			t.Errorf("CALLBACK_CONTENT_TYPE=%q: Content-Type %q, want %q", tc.env, ct, tc.want)
+		}
+	}
+}
+
+func TestFitCallbackPayloadTrimsOversized(t *testing.T) {
+	total := 100.0
+	payload := calcResult{
+		CalculationID: 5,
+		Status:        "success",
+		TotalCost:     &total,
+		Note:          "calculated by async service",
+		Request:       &calcRequest{CalculationID: 5, Metadata: map[string]string{"blob": strings.Repeat("x", 2000)}},
+		Warnings:      []string{"quantity missing for service 1, defaulted to 1"},
+	}
+
+	full, err := fitCallbackPayload(payload, 0)
+	if err != nil || len(full) < 2000 {
+		t.Fatalf("without a limit: %d bytes, err %v", len(full), err)
+	}
+
+	body, err := fitCallbackPayload(payload, 400)
+	if err != nil || len(body) > 400 {
+		t.Fatalf("limit 400: %d bytes, err %v", len(body), err)
+	}
+	var got calcResult
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Request != nil || len(got.Warnings) != 1 || got.Note != "calculated by async service; payload trimmed, dropped: request" {
+		t.Fatalf("limit 400: %+v", got)
+	}
+
+	// Не помещается даже без необязательных полей — уходит минимальный результат
+	body, err = fitCallbackPayload(payload, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = calcResult{}
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.CalculationID != 5 || *got.TotalCost != 100 || got.Warnings != nil || got.Note != "payload too large, minimal result sent" {
+		t.Fatalf("limit 50: %+v", got)
+	}
+}
+
+func TestSafeRetryConditions(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		safe bool
+	}{
+		{"connection refused", errors.New("dial tcp: connection refused"), true},
+		{"429", &callbackStatusError{Code: http.StatusTooManyRequests}, true},
+		{"503", &callbackStatusError{Code: http.StatusServiceUnavailable}, true},
+		{"500 with Retry-After", &callbackStatusError{Code: http.StatusInternalServerError, RetryAfter: true}, true},
+		{"500", &callbackStatusError{Code: http.StatusInternalServerError}, false},
+		{"400", &callbackStatusError{Code: http.StatusBadRequest}, false},
+	}
+	for _, tc := range cases {
+		if !retryableCallbackError(tc.err, "all") {
+			t.Errorf("%s: not retried under all", tc.name)
+		}
+		if got := retryableCallbackError(tc.err, "safe"); got != tc.safe {
+			t.Errorf("%s: retried under safe = %t, want %t", tc.name, got, tc.safe)
+		}
+	}
+
+	// 500 под safe — одна попытка, без повторов
+	useFakeClock(t)
+	fs := useFakeSender(t)
+	fs.fail = func(string, int) error { return &callbackStatusError{Code: http.StatusInternalServerError} }
+	t.Setenv("CALLBACK_RETRY_CONDITIONS", "safe")
+	sendCallback(context.Background(), "http://receiver", "", calcResult{CalculationID: 1, Status: "success"})
+	if n := fs.attempts("http://receiver"); n != 1 {
+		t.Fatalf("attempts after 500 under safe = %d, want 1", n)
+	}
+}
+
+func TestCallbackGzipRoundTrip(t *testing.T) {
+	var encoding string
+	var received []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		body := io.Reader(r.Body)
+		if encoding == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			body = zr
+		}
+		received, _ = io.ReadAll(body)
+	}))
+	defer srv.Close()
+	swap[CallbackSender](t, &callbackSender, newHTTPCallbackSender())
+
+	total := 1234.5
+	payload := calcResult{CalculationID: 3, Status: "success", TotalCost: &total, Note: strings.Repeat("long note ", 50)}
+	want, err := marshalCallback(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if to := sendCallback(withCallbackGzip(context.Background()), srv.URL, "", payload); to != srv.URL {
+		t.Fatal("gzip callback not delivered")
+	}
+	if encoding != "gzip" || string(received) != string(want) {
+		t.Fatalf("gzip: Content-Encoding %q, body %s", encoding, received)
+	}
+
+	if to := sendCallback(context.Background(), srv.URL, "", payload); to != srv.URL {
+		t.Fatal("plain callback not delivered")
+	}
+	if encoding != "" || string(received) != string(want) {
+		t.Fatalf("plain: Content-Encoding %q, body %s", encoding, received)
+	}
+}
+
+func TestPerRequestCallbackOverrides(t *testing.T) {
+	useDeterministic(t)
+	useFakeClock(t)
+	useStatusStore(t)
+	t.Setenv("CALLBACK_MAX_RETRIES", "3")
+	var attempts int
+	var timeout time.Duration
+	swap[CallbackSender](t, &callbackSender, senderFunc(func(ctx context.Context, _ string, _ []byte) error {
+		attempts++
+		deadline, _ := ctx.Deadline()
+		timeout = time.Until(deadline)
+		return errors.New("connection refused")
+	}))
+	run := func(body string) {
+		var req calcRequest
+		if err := json.Unmarshal([]byte(body), &req); err != nil {
+			t.Fatal(err)
+		}
+		attempts = 0
+		handleAsync(context.Background(), req)
+	}
+
+	run(`{"calculation_id": 1, "callback_url": "http://receiver", "services": []}`)
+	if attempts != 4 {
+		t.Fatalf("global CALLBACK_MAX_RETRIES: %d attempts, want 4", attempts)
+	}
+	run(`{"calculation_id": 2, "callback_url": "http://receiver", "services": [], "callback_max_retries": 0, "callback_timeout_ms": 250}`)
+	if attempts != 1 || timeout <= 0 || timeout > 250*time.Millisecond {
+		t.Fatalf("overrides: %d attempts, timeout %s; want 1 attempt within 250ms", attempts, timeout)
+	}
+
+	router := route(http.MethodPost, "/process", processHandler)
+	for _, field := range []string{`"callback_timeout_ms": 50`, `"callback_timeout_ms": 60001`, `"callback_max_retries": -1`, `"callback_max_retries": 11`} {
+		body := `{"calculation_id": 3, "callback_url": "http://receiver", "services": [], ` + field + `}`
+		if rec := serve(router, http.MethodPost, "/process", body, "Content-Type", "application/json"); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", field, rec.Code)
+		}
+	}
+}
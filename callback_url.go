@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// callbackPlaceholder — подстановка в callback_url, например
+// http://host/api/calculation/{id}/result?status={status}.
+var callbackPlaceholder = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// validateCallbackURL проверяет, что в шаблоне только известные подстановки
+// ({id}, {status}) и что после подстановки получается абсолютный URL.
+func validateCallbackURL(template string) error {
+	for _, m := range callbackPlaceholder.FindAllStringSubmatch(template, -1) {
+		switch m[1] {
+		case "id", "status":
+		default:
+			return fmt.Errorf("callback_url: unknown placeholder {%s}", m[1])
+		}
+	}
+	u, err := url.Parse(expandCallbackURL(template, 0, "pending"))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("callback_url: must be an absolute URL")
+	}
+	return nil
+}
+
+func hasCallbackPlaceholders(template string) bool {
+	return callbackPlaceholder.MatchString(template)
+}
+
+// expandCallbackURL подставляет ID заявки и статус результата.
+func expandCallbackURL(template string, id int, status string) string {
+	return callbackPlaceholder.ReplaceAllStringFunc(template, func(m string) string {
+		switch m {
+		case "{id}":
+			return strconv.Itoa(id)
+		case "{status}":
+			return url.PathEscape(status)
+		}
+		return m
+	})
+}
+
+// probeClient — общий клиент проверок доступности. Создаётся один раз:
+// отдельный Transport на каждую заявку оставлял бы открытые соединения.
+// Соединения не переиспользуются — проверки редкие и к разным хостам.
+var probeClient = sync.OnceValue(func() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:             callbackProxy(getEnv("CALLBACK_PROXY_URL", "")),
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+})
+
+// probeCallbackURL проверяет HEAD-запросом, что получатель колбэка вообще
+// доступен (VERIFY_CALLBACK_REACHABILITY). Любой HTTP-ответ, даже 405,
+// считается доступностью — ошибкой будут только сетевые сбои и таймаут
+// CALLBACK_PROBE_TIMEOUT (2 секунды по умолчанию).
+func probeCallbackURL(ctx context.Context, template string, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, getEnvDuration("CALLBACK_PROBE_TIMEOUT", 2*time.Second))
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, expandCallbackURL(template, id, "pending"), nil)
+	if err != nil {
+		return fmt.Errorf("callback_url: %v", err)
+	}
+	resp, err := probeClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("callback_url is unreachable: %v", err)
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidateCallbackURLTemplate(t *testing.T) {
+	cases := []struct {
+		template string
+		ok       bool
+	}{
+		{"http://host/api/calculation/{id}/result?status={status}", true},
+		{"http://host/{id}", true},
+		{"http://host/hook", true},
+		{"http://host/{user}/result", false},
+		{"{id}/result", false},
+	}
+	for _, tc := range cases {
+		if err := validateCallbackURL(tc.template); (err == nil) != tc.ok {
+			t.Errorf("%q: err = %v, want ok=%t", tc.template, err, tc.ok)
+		}
+	}
+}
+
+func TestTemplatedCallbackURL(t *testing.T) {
+	if got := expandCallbackURL("http://host/{id}/{status}/{id}", 7, "a b"); got != "http://host/7/a%20b/7" {
+		t.Fatalf("expanded = %q", got)
+	}
+
+	useDeterministic(t)
+	useStatusStore(t)
+	fs := useFakeSender(t)
+	body := `{"calculation_id": 55, "callback_url": "http://receiver/calc/{id}?status={status}", "services": []}`
+	rec := serve(route(http.MethodPost, "/process", processHandler), http.MethodPost, "/process", body, "Content-Type", "application/json")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	waitDelivered(t, 55)
+	if sent := fs.delivered(); len(sent) != 1 || sent[0].URL != "http://receiver/calc/55?status=success" {
+		t.Fatalf("sent = %+v", sent)
+	}
+
+	body = `{"calculation_id": 56, "callback_url": "http://receiver/{calc}", "services": []}`
+	rec = serve(route(http.MethodPost, "/process", processHandler), http.MethodPost, "/process", body, "Content-Type", "application/json")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("unknown placeholder: status %d, want 400", rec.Code)
+	}
+}
+
+func TestProbeCallbackURL(t *testing.T) {
+	var method, path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	defer srv.Close()
+
+	// Любой HTTP-ответ, даже 405, означает доступность
+	if err := probeCallbackURL(context.Background(), srv.URL+"/calc/{id}", 8); err != nil {
+		t.Fatalf("reachable: %v", err)
+	}
+	if method != http.MethodHead || path != "/calc/8" {
+		t.Fatalf("probe sent %s %s", method, path)
+	}
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	if err := probeCallbackURL(context.Background(), closed.URL, 8); err == nil {
+		t.Fatal("unreachable: expected an error")
+	}
+
+	useStatusStore(t)
+	t.Setenv("VERIFY_CALLBACK_REACHABILITY", "true")
+	body := `{"calculation_id": 9, "callback_url": "` + closed.URL + `", "services": []}`
+	rec := serve(route(http.MethodPost, "/process", processHandler), http.MethodPost, "/process", body, "Content-Type", "application/json")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("/process with unreachable callback_url: status %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import "time"
+
+// Clock — источник текущего времени и ожидания для логики, зависящей от
+// времени: задержек, run_at, TTL и окон. Подменяется в тестах часами,
+// которые переводятся вручную.
+type Clock interface {
+	Now() time.Time
+	// After срабатывает через d, как time.After.
+	After(d time.Duration) <-chan time.Time
+	Sleep(d time.Duration)
+}
+
+// clock — часы сервиса; в тестах заменяется подделкой.
+var clock Clock = realClock{}
+
+// realClock — системное время.
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
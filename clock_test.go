@@ -0,0 +1,157 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock — часы для тестов: время стоит, пока его не переведут Advance.
+// Sleep не ждёт, а сразу переводит часы и запоминает паузу.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+	slept   []time.Duration
+}
+
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+// useFakeClock подменяет clock на время теста.
+func useFakeClock(t *testing.T) *fakeClock {
+	t.Helper()
+	fc := newFakeClock()
+	prev := clock
+	clock = fc
+	t.Cleanup(func() { clock = prev })
+	return fc
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, fakeWaiter{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	c.slept = append(c.slept, d)
+	c.mu.Unlock()
+	c.Advance(d)
+}
+
+// Advance переводит часы на d и срабатывает наступившие After.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			pending = append(pending, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = pending
+}
+
+// sleeps — паузы, выдержанные через Sleep.
+func (c *fakeClock) sleeps() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]time.Duration(nil), c.slept...)
+}
+
+// waitForWaiters ждёт, пока n горутин не встанут на After.
+func (c *fakeClock) waitForWaiters(t *testing.T, n int) {
+	t.Helper()
+	eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return len(c.waiters) >= n
+	})
+}
+
+// eventually ждёт выполнения условия, которое наступает в другой горутине.
+func eventually(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in 2s")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestTrackProgressFollowsClock(t *testing.T) {
+	fc := useFakeClock(t)
+	store := useStatusStore(t)
+	store.start(calcRequest{CalculationID: 1})
+
+	stop := trackProgress(1, 4*time.Second, 4)
+	defer stop()
+
+	for _, want := range []int{25, 50, 75} {
+		fc.waitForWaiters(t, 1)
+		fc.Advance(time.Second)
+		eventually(t, func() bool {
+			status, _ := store.get(1)
+			return status.Progress == want
+		})
+	}
+	status, _ := store.get(1)
+	if status.Progress != 75 {
+		t.Fatalf("progress = %d, want 75", status.Progress)
+	}
+}
+
+func TestStatusEventsTimeoutFollowsClock(t *testing.T) {
+	fc := useFakeClock(t)
+	store := useStatusStore(t)
+	store.start(calcRequest{CalculationID: 7})
+
+	router := route(http.MethodGet, "/process/:id/events", statusEventsHandler)
+	var rec *httptest.ResponseRecorder
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		rec = serve(router, http.MethodGet, "/process/7/events", "")
+	}()
+
+	// Тайм-аут потока и первый опрос
+	fc.waitForWaiters(t, 2)
+	fc.Advance(time.Minute)
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream did not close after SSE_TIMEOUT")
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "event:pending") || !strings.Contains(body, "event:timeout") {
+		t.Fatalf("unexpected stream:\n%s", body)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// compareRequest — сравнение итога при разных способах оплаты периодических
+// услуг: все они по очереди считаются как каждый из scenarios.
+type compareRequest struct {
+	Services []serviceItem `json:"services" binding:"required,min=1,dive"`
+	Months   int           `json:"months" binding:"required,min=1"`
+	// Scenarios — типы периодической оплаты для сравнения, по умолчанию
+	// monthly и yearly.
+	Scenarios             []string `json:"scenarios,omitempty" binding:"omitempty,dive,oneof=daily monthly yearly"`
+	Currency              string   `json:"currency,omitempty"`
+	AnnualIncreasePercent float64  `json:"annual_increase_percent,omitempty" binding:"omitempty,min=0,max=100"`
+}
+
+// compareScenario — итог одного сценария.
+type compareScenario struct {
+	PriceType      string  `json:"price_type"`
+	TotalCost      float64 `json:"total_cost"`
+	DurationMonths int     `json:"duration_months"`
+}
+
+type compareResult struct {
+	Currency  string            `json:"currency"`
+	Scenarios []compareScenario `json:"scenarios"`
+}
+
+// monthsPerPeriod — длина периода оплаты в месяцах для пересчёта цены
+// между сценариями. Дней в месяце столько же, сколько в расчёте заявки
+// (period.days), чтобы сценарий daily совпадал с /process.
+var monthsPerPeriod = map[string]float64{"daily": 1 / float64(period{Months: 1}.days()), "monthly": 1, "yearly": 12}
+
+// asPriceType переводит периодические строки на priceType с ценой за
+// равный по длительности период: monthly 100 становится yearly 1200.
+// Разовые и процентные строки не меняются. Исходный срез не меняется.
+func asPriceType(items []serviceItem, priceType string) []serviceItem {
+	converted := make([]serviceItem, len(items))
+	for i, it := range items {
+		if from := normalizePriceType(it.PriceType); isRecurringPriceType(from) {
+			scale := monthsPerPeriod[priceType] / monthsPerPeriod[from]
+			it.Price *= scale
+			it.OveragePrice *= scale
+			it.PriceType = priceType
+		}
+		converted[i] = it
+	}
+	return converted
+}
+
+// compareHandler синхронно считает итог заявки в каждом сценарии, без
+// колбэка и случайного исхода.
+func compareHandler(c *gin.Context) {
+	if !isJSONContentType(c.GetHeader("Content-Type")) {
+		writeError(c, errUnsupportedMediaType("content type must be application/json"))
+		return
+	}
+
+	var req compareRequest
+	if err := bindJSON(c, &req); err != nil {
+		writeError(c, err)
+		return
+	}
+	for _, it := range req.Services {
+		if err := validateService(it); err != nil {
+			writeError(c, errValidation(fmt.Sprintf("service %d: %v", it.ID, err)))
+			return
+		}
+	}
+	scenarios := req.Scenarios
+	if len(scenarios) == 0 {
+		scenarios = []string{"monthly", "yearly"}
+	}
+
+	currency := normalizeCurrency(req.Currency)
+	if currency == "" {
+		currency = defaultCurrency
+	}
+	opts := calcOptions{AnnualIncreasePercent: req.AnnualIncreasePercent}
+	res := compareResult{Currency: currency}
+	for _, priceType := range scenarios {
+		out := calculate(asPriceType(req.Services, priceType), &req.Months, opts)
+		res.Scenarios = append(res.Scenarios, compareScenario{
+			PriceType:      priceType,
+			TotalCost:      roundTo(out.Total, currencyPrecision(currency)),
+			DurationMonths: out.DurationMonths,
+		})
+	}
+	c.JSON(http.StatusOK, res)
+}
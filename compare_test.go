@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestCompareScenarios(t *testing.T) {
+	router := route(http.MethodPost, "/compare", compareHandler)
+	compare := func(body string) compareResult {
+		t.Helper()
+		rec := serve(router, http.MethodPost, "/compare", body, "Content-Type", "application/json")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+		var res compareResult
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	services := `"services": [
+		{"id": 1, "price": 100, "price_type": "monthly", "quantity": 1},
+		{"id": 2, "price": 50, "price_type": "one_time", "quantity": 1}
+	]`
+
+	// По умолчанию monthly и yearly; разовая строка одинакова во всех сценариях
+	res := compare(`{` + services + `, "months": 24}`)
+	want := []compareScenario{
+		{PriceType: "monthly", TotalCost: 2450, DurationMonths: 24},
+		{PriceType: "yearly", TotalCost: 2450, DurationMonths: 24},
+	}
+	if !reflect.DeepEqual(res.Scenarios, want) {
+		t.Fatalf("default scenarios = %+v, want %+v", res.Scenarios, want)
+	}
+
+	// На коротком сроке годовая оплата дороже: год оплачивается целиком,
+	// посуточная считается по 30 дней в месяце
+	res = compare(`{` + services + `, "months": 6, "scenarios": ["daily", "monthly", "yearly"]}`)
+	want = []compareScenario{
+		{PriceType: "daily", TotalCost: 650, DurationMonths: 6},
+		{PriceType: "monthly", TotalCost: 650, DurationMonths: 6},
+		{PriceType: "yearly", TotalCost: 1250, DurationMonths: 6},
+	}
+	if !reflect.DeepEqual(res.Scenarios, want) {
+		t.Fatalf("6 months = %+v, want %+v", res.Scenarios, want)
+	}
+
+	if rec := serve(router, http.MethodPost, "/compare", `{`+services+`, "months": 6, "scenarios": ["weekly"]}`, "Content-Type", "application/json"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("unknown scenario: status %d, want 400", rec.Code)
+	}
+}
+
+func TestCompareDailyMatchesProcess(t *testing.T) {
+	useDeterministic(t)
+	useStatusStore(t)
+	fs := useFakeSender(t)
+
+	// monthly 90 в сценарии daily — это daily 3, как в заявке /process
+	rec := serve(route(http.MethodPost, "/compare", compareHandler), http.MethodPost, "/compare",
+		`{"services": [{"id": 1, "price": 90, "price_type": "monthly", "quantity": 1}], "months": 12, "scenarios": ["daily"]}`,
+		"Content-Type", "application/json")
+	var res compareResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil || len(res.Scenarios) != 1 {
+		t.Fatalf("compare: status %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = serve(route(http.MethodPost, "/process", processHandler), http.MethodPost, "/process",
+		`{"calculation_id": 1, "callback_url": "http://receiver", "services": [{"id": 1, "price": 3, "price_type": "daily", "quantity": 1}]}`,
+		"Content-Type", "application/json")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("process: status %d: %s", rec.Code, rec.Body)
+	}
+	waitDelivered(t, 1)
+	result := decodeResult(t, fs.delivered()[0])
+	if result.TotalCost == nil {
+		t.Fatalf("process: no total_cost: %+v", result)
+	}
+	if *result.TotalCost != res.Scenarios[0].TotalCost {
+		t.Fatalf("process total %v, compare daily total %v", *result.TotalCost, res.Scenarios[0].TotalCost)
+	}
+}
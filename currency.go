@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// defaultCurrency — валюта цен, если в заявке не указана currency.
+const defaultCurrency = "RUB"
+
+// exchangeRates — источник курсов для target_currencies. Инициализируется в main.
+var exchangeRates rateProvider = staticRates{defaultCurrency: 1}
+
+// rateProvider возвращает курс пересчёта одной валюты в другую.
+type rateProvider interface {
+	rate(from, to string) (float64, error)
+}
+
+// staticRates — таблица курсов: стоимость единицы валюты в общей опорной
+// единице (например, RUB=1,USD=90,EUR=100).
+type staticRates map[string]float64
+
+func (r staticRates) rate(from, to string) (float64, error) {
+	fromRate, ok := r[from]
+	if !ok {
+		return 0, fmt.Errorf("unknown currency %s", from)
+	}
+	toRate, ok := r[to]
+	if !ok {
+		return 0, fmt.Errorf("unknown currency %s", to)
+	}
+	return fromRate / toRate, nil
+}
+
+// parseRates разбирает таблицу курсов вида "RUB=1,USD=90.5".
+func parseRates(value string) (staticRates, error) {
+	rates := staticRates{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		code, rateStr, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate %q", pair)
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(rateStr), 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("invalid rate %q", pair)
+		}
+		rates[normalizeCurrency(code)] = rate
+	}
+	return rates, nil
+}
+
+func normalizeCurrency(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// currencyPrecision — число знаков после запятой для валюты.
+func currencyPrecision(code string) int {
+	switch code {
+	case "JPY", "KRW", "VND", "CLP", "ISK":
+		return 0
+	default:
+		return 2
+	}
+}
+
+func roundTo(value float64, precision int) float64 {
+	return roundWithMode(value, precision, "nearest")
+}
+
+// toMinorUnits переводит уже округлённую до precision сумму в целое число
+// минимальных единиц валюты (копеек, центов). math.Round убирает шум
+// двоичного представления: 19.99*100 = 1998.9999999999998.
+func toMinorUnits(value float64, precision int) int64 {
+	return int64(math.Round(value * math.Pow10(precision)))
+}
+
+// roundWithMode округляет до precision знаков в направлении mode:
+// up — вверх, down — вниз, nearest (и пустое значение) — к ближайшему.
+func roundWithMode(value float64, precision int, mode string) float64 {
+	p := math.Pow10(precision)
+	// Убираем шум двоичного представления (0.1*3*100 = 30.000000000000004),
+	// иначе up/down срабатывают на «лишнюю» единицу.
+	scaled := math.Round(value*p*1e6) / 1e6
+	switch mode {
+	case "up":
+		scaled = math.Ceil(scaled)
+	case "down":
+		scaled = math.Floor(scaled)
+	default:
+		scaled = math.Round(scaled)
+	}
+	return scaled / p
+}
+
+// roundToIncrement округляет value до кратного increment (0.05, 1) в
+// направлении mode, как roundWithMode. Результат приводится к precision
+// знаков, чтобы 0.05*3 не превращалось в 0.15000000000000002.
+func roundToIncrement(value, increment float64, precision int, mode string) float64 {
+	steps := roundWithMode(value/increment, 0, mode)
+	return roundTo(steps*increment, precision)
+}
+
+// convertTotals пересчитывает сумму в каждую из целевых валют. Ошибка по
+// одной валюте не мешает остальным.
+func convertTotals(total float64, from string, targets []string, rates rateProvider) (map[string]float64, map[string]string) {
+	converted := map[string]float64{}
+	failed := map[string]string{}
+	for _, target := range targets {
+		target = normalizeCurrency(target)
+		rate, err := rates.rate(from, target)
+		if err != nil {
+			failed[target] = err.Error()
+			continue
+		}
+		converted[target] = roundTo(total*rate, currencyPrecision(target))
+	}
+	if len(converted) == 0 {
+		converted = nil
+	}
+	if len(failed) == 0 {
+		failed = nil
+	}
+	return converted, failed
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConvertTotals(t *testing.T) {
+	rates, err := parseRates("RUB=1, usd=90, EUR=100, JPY=0.6")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	converted, failed := convertTotals(9000, "RUB", []string{"USD", "eur", "JPY", "GBP"}, rates)
+	wantConverted := map[string]float64{"USD": 100, "EUR": 90, "JPY": 15000}
+	if !reflect.DeepEqual(converted, wantConverted) {
+		t.Fatalf("converted = %v, want %v", converted, wantConverted)
+	}
+	wantFailed := map[string]string{"GBP": "unknown currency GBP"}
+	if !reflect.DeepEqual(failed, wantFailed) {
+		t.Fatalf("conversion errors = %v, want %v", failed, wantFailed)
+	}
+
+	// Пересчёт из валюты не из таблицы не удаётся ни для одной цели
+	converted, failed = convertTotals(10, "CHF", []string{"RUB"}, rates)
+	if converted != nil || failed["RUB"] != "unknown currency CHF" {
+		t.Fatalf("from unknown currency: converted = %v, errors = %v", converted, failed)
+	}
+}
+
+func TestParseRatesRejectsInvalid(t *testing.T) {
+	for _, value := range []string{"USD", "USD=abc", "USD=0", "USD=-1"} {
+		if _, err := parseRates(value); err == nil {
+			t.Errorf("parseRates(%q) succeeded, want error", value)
+		}
+	}
+}
+
+func TestRoundWithMode(t *testing.T) {
+	for _, tc := range []struct {
+		mode string
+		want float64
+	}{
+		{"up", 100},
+		{"down", 99.99},
+		{"nearest", 100},
+		{"", 100},
+	} {
+		if got := roundWithMode(99.995, 2, tc.mode); got != tc.want {
+			t.Errorf("roundWithMode(99.995, %q) = %v, want %v", tc.mode, got, tc.want)
+		}
+	}
+	// Шум двоичного представления не сдвигает up и down на лишнюю единицу
+	if got := roundWithMode(0.1*3, 2, "up"); got != 0.3 {
+		t.Errorf("roundWithMode(0.1*3, up) = %v, want 0.3", got)
+	}
+	if got := roundWithMode(1999.5, 0, "down"); got != 1999 {
+		t.Errorf("roundWithMode(1999.5, 0, down) = %v, want 1999", got)
+	}
+}
+
+func TestRoundingModeInResult(t *testing.T) {
+	useDeterministic(t)
+	for mode, want := range map[string]float64{"up": 100, "down": 99.99, "nearest": 100} {
+		result := computeResult(calcRequest{
+			RoundingMode: mode,
+			Services:     []serviceItem{{ID: 1, Price: 99.995, PriceType: "one_time", Quantity: 1}},
+		})
+		if *result.TotalCost != want {
+			t.Errorf("rounding_mode %s: total_cost = %v, want %v", mode, *result.TotalCost, want)
+		}
+	}
+}
+
+func TestBaseCurrencyConversion(t *testing.T) {
+	useDeterministic(t)
+	rates, err := parseRates("RUB=1, USD=90, JPY=0.6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	swap[rateProvider](t, &exchangeRates, rates)
+	oneTime := func(currency string, price float64) calcRequest {
+		return calcRequest{Currency: currency, Services: []serviceItem{{ID: 1, Price: price, PriceType: "one_time", Quantity: 1}}}
+	}
+
+	t.Setenv("BASE_CURRENCY", "RUB")
+	result := computeResult(oneTime("USD", 100))
+	if *result.TotalCost != 9000 || result.Currency != "RUB" || *result.OriginalTotalCost != 100 || result.OriginalCurrency != "USD" {
+		t.Fatalf("USD to RUB: %+v", result)
+	}
+	if result = computeResult(oneTime("RUB", 100)); *result.TotalCost != 100 || result.OriginalTotalCost != nil {
+		t.Fatalf("already in RUB: %+v", result)
+	}
+
+	// 1000 JPY = 600 RUB = 6.666… USD, округляется по точности USD
+	t.Setenv("BASE_CURRENCY", "USD")
+	if result = computeResult(oneTime("JPY", 1000)); *result.TotalCost != 6.67 || *result.OriginalTotalCost != 1000 {
+		t.Fatalf("JPY to USD: total %v, original %v", *result.TotalCost, *result.OriginalTotalCost)
+	}
+
+	t.Setenv("BASE_CURRENCY", "GBP")
+	result = computeResult(oneTime("USD", 100))
+	if *result.TotalCost != 100 || result.Currency != "USD" || !reflect.DeepEqual(result.Warnings, []string{"total_cost not converted to base currency: unknown currency GBP"}) {
+		t.Fatalf("unknown base currency: %+v", result)
+	}
+}
+
+func TestMinorUnits(t *testing.T) {
+	useDeterministic(t)
+	req := calcRequest{Currency: "USD", MinorUnits: true, Services: []serviceItem{
+		{ID: 1, Price: 0.1, PriceType: "one_time", Quantity: 1},
+		{ID: 2, Price: 0.2, PriceType: "one_time", Quantity: 1},
+		{ID: 3, Price: 19.99, PriceType: "one_time", Quantity: 3},
+	}}
+	result := computeResult(req)
+	if result.TotalCostMinor == nil {
+		t.Fatal("USD: total_cost_minor is missing")
+	}
+	if *result.TotalCost != 60.27 || *result.TotalCostMinor != 6027 {
+		t.Fatalf("USD: total %v, minor %d", *result.TotalCost, *result.TotalCostMinor)
+	}
+
+	// У иены нет дробной части: минимальная единица — сама иена
+	req.Currency = "JPY"
+	req.Services = []serviceItem{{ID: 1, Price: 1500, PriceType: "one_time", Quantity: 1}}
+	if result = computeResult(req); *result.TotalCostMinor != 1500 {
+		t.Fatalf("JPY: minor %d, want 1500", *result.TotalCostMinor)
+	}
+
+	req.MinorUnits = false
+	if result = computeResult(req); result.TotalCostMinor != nil {
+		t.Fatalf("without minor_units: total_cost_minor = %d", *result.TotalCostMinor)
+	}
+}
+
+func TestRoundToIncrement(t *testing.T) {
+	for _, tc := range []struct {
+		value, increment float64
+		mode             string
+		want             float64
+	}{
+		{10.12, 0.05, "nearest", 10.1},
+		{10.13, 0.05, "nearest", 10.15},
+		{10.11, 0.05, "up", 10.15},
+		{10.14, 0.05, "down", 10.1},
+		{10.5, 1, "nearest", 11},
+		{10.01, 1, "up", 11},
+		{10.99, 1, "down", 10},
+		// Уже кратное шагу значение не сдвигается
+		{10.15, 0.05, "up", 10.15},
+	} {
+		if got := roundToIncrement(tc.value, tc.increment, 2, tc.mode); got != tc.want {
+			t.Errorf("roundToIncrement(%v, %v, %q) = %v, want %v", tc.value, tc.increment, tc.mode, got, tc.want)
+		}
+	}
+
+	useDeterministic(t)
+	result := computeResult(calcRequest{RoundingIncrement: 0.05, Services: []serviceItem{{ID: 1, Price: 3.33, PriceType: "one_time", Quantity: 1}}})
+	if *result.TotalCost != 3.35 {
+		t.Fatalf("rounding_increment 0.05: total %v, want 3.35", *result.TotalCost)
+	}
+}
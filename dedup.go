@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// requestDedup подавляет повторную отправку идентичной заявки в пределах окна.
+// Инициализируется в main.
+var requestDedup *dedupStore
+
+// dedupStore помнит хеши недавних заявок. Размер ограничен maxEntries:
+// при переполнении сначала удаляются просроченные, затем самые старые записи.
+type dedupStore struct {
+	mu         sync.Mutex
+	window     time.Duration
+	maxEntries int
+	seenAt     map[string]time.Time
+}
+
+func newDedupStore(window time.Duration, maxEntries int) *dedupStore {
+	return &dedupStore{window: window, maxEntries: maxEntries, seenAt: map[string]time.Time{}}
+}
+
+// requestHash — хеш заявки. json.Marshal выдаёт поля структуры в фиксированном
+// порядке, поэтому одинаковые заявки дают одинаковый хеш.
+func requestHash(req calcRequest) string {
+	body, _ := json.Marshal(req)
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalRequestHash — request_hash для колбэка: hex(SHA-256) от
+// присланного JSON-объекта заявки в каноническом виде — компактно, ключи
+// отсортированы на всех уровнях, числа и строки как в запросе. Поэтому
+// порядок полей и пробелы на хеш не влияют, и получатель пересчитывает его
+// по отправленной заявке. В пакете это элемент calculations, а не всё тело.
+func canonicalRequestHash(raw []byte) string {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var tree any
+	if err := dec.Decode(&tree); err != nil {
+		return ""
+	}
+	// encoding/json выдаёт ключи map отсортированными
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(tree); err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// seen отмечает заявку и сообщает, встречалась ли она в пределах окна.
+func (d *dedupStore) seen(hash string) bool {
+	if d == nil || d.window <= 0 {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := clock.Now()
+	if at, ok := d.seenAt[hash]; ok && now.Sub(at) < d.window {
+		return true
+	}
+	if d.maxEntries > 0 && len(d.seenAt) >= d.maxEntries {
+		d.evict(now)
+	}
+	d.seenAt[hash] = now
+	return false
+}
+
+func (d *dedupStore) sweep(now time.Time) int {
+	if d == nil {
+		return 0
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	removed := 0
+	for k, at := range d.seenAt {
+		if now.Sub(at) >= d.window {
+			delete(d.seenAt, k)
+			removed++
+		}
+	}
+	return removed
+}
+
+func (d *dedupStore) evict(now time.Time) {
+	var oldestKey string
+	var oldestAt time.Time
+	for k, at := range d.seenAt {
+		if now.Sub(at) >= d.window {
+			delete(d.seenAt, k)
+			continue
+		}
+		if oldestKey == "" || at.Before(oldestAt) {
+			oldestKey, oldestAt = k, at
+		}
+	}
+	if len(d.seenAt) >= d.maxEntries && oldestKey != "" {
+		delete(d.seenAt, oldestKey)
+	}
+}
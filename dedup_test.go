@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRequestHashIsStable(t *testing.T) {
+	useDeterministic(t)
+	useStatusStore(t)
+	fs := useFakeSender(t)
+	router := route(http.MethodPost, "/process", processHandler)
+
+	// Порядок ключей и пробелы на хеш не влияют; числа и лишние поля
+	// входят как присланы
+	bodies := []string{
+		`{"calculation_id": 91, "callback_url": "http://receiver", "services": [{"id": 1, "price": 10.0, "price_type": "monthly"}], "client_ref": "x"}`,
+		"\n  {\"services\":[{\"price_type\":\"monthly\",\"price\":10.0,\"id\":1}],\n\"client_ref\":\"x\",  \"callback_url\":\"http://receiver\",\"calculation_id\":91}\n",
+	}
+	canonical := `{"calculation_id":91,"callback_url":"http://receiver","client_ref":"x","services":[{"id":1,"price":10.0,"price_type":"monthly"}]}`
+	sum := sha256.Sum256([]byte(canonical))
+	want := hex.EncodeToString(sum[:])
+	for _, body := range bodies {
+		rec := serve(router, http.MethodPost, "/process", body, "Content-Type", "application/json")
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+		waitDelivered(t, 91)
+	}
+	sent := fs.delivered()
+	if len(sent) != 2 {
+		t.Fatalf("sent %d callbacks", len(sent))
+	}
+	for _, cb := range sent {
+		if got := decodeResult(t, cb).RequestHash; got != want {
+			t.Fatalf("request_hash = %q, want %q", got, want)
+		}
+	}
+
+	// В пакете хеш считается по элементу calculations
+	item := `{"calculation_id": 92, "services": [{"id": 1, "price": 5, "price_type": "one_time", "quantity": 1}]}`
+	sum = sha256.Sum256([]byte(`{"calculation_id":92,"services":[{"id":1,"price":5,"price_type":"one_time","quantity":1}]}`))
+	rec := serve(route(http.MethodPost, "/process/batch/stream", batchStreamHandler), http.MethodPost, "/process/batch/stream",
+		`{"calculations": [`+item+`]}`, "Content-Type", "application/json")
+	var result calcResult
+	if err := json.Unmarshal([]byte(strings.TrimSpace(rec.Body.String())), &result); err != nil {
+		t.Fatalf("stream: %v: %s", err, rec.Body)
+	}
+	if result.RequestHash != hex.EncodeToString(sum[:]) {
+		t.Fatalf("batch item request_hash = %q", result.RequestHash)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"time"
+)
+
+// deterministic — режим для snapshot-тестов (DETERMINISTIC): без задержки,
+// всегда успешный расчёт и фиксированное время в статусах и sandbox, чтобы
+// колбэки можно было сравнивать с эталонными файлами. Заменяет набор
+// DELAY_DISTRIBUTION=fixed, DELAY_MEAN=0 и SIMULATE_FAILURE_RATE=0.
+var deterministic bool
+
+// deterministicTime — время, которое now возвращает в режиме deterministic.
+var deterministicTime = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// now — время для данных, попадающих в ответы (created_at, captured_at).
+func now() time.Time {
+	if deterministic {
+		return deterministicTime
+	}
+	return clock.Now()
+}
+
+// processingDelay возвращает искусственную задержку обработки заявки
+// (в режиме deterministic — ноль). Распределение задаётся DELAY_DISTRIBUTION:
+//   - uniform (по умолчанию) — целое число секунд от 5 до 9;
+//   - fixed — ровно DELAY_MEAN;
+//   - normal — нормальное распределение вокруг DELAY_MEAN с DELAY_STDDEV.
+//
+// С DELAY_PER_SERVICE к задержке добавляется это значение за каждую из
+// services строк заявки, но не больше DELAY_MAX (0 — без ограничения):
+// большие заявки «считаются» дольше. Отрицательные значения обрезаются
+// до нуля.
+func processingDelay(services int) time.Duration {
+	if deterministic {
+		return 0
+	}
+	mean := getEnvDuration("DELAY_MEAN", 7*time.Second)
+
+	var delay time.Duration
+	switch dist := getEnv("DELAY_DISTRIBUTION", "uniform"); dist {
+	case "uniform":
+		delay = time.Duration(rand.Intn(5)+5) * time.Second
+	case "fixed":
+		delay = mean
+	case "normal":
+		stddev := getEnvDuration("DELAY_STDDEV", time.Second)
+		delay = mean + time.Duration(rand.NormFloat64()*float64(stddev))
+	default:
+		log.Printf("unknown DELAY_DISTRIBUTION=%q, using uniform", dist)
+		delay = time.Duration(rand.Intn(5)+5) * time.Second
+	}
+
+	if perService := getEnvDuration("DELAY_PER_SERVICE", 0); perService > 0 {
+		delay += time.Duration(services) * perService
+		if limit := getEnvDuration("DELAY_MAX", 0); limit > 0 && delay > limit {
+			delay = limit
+		}
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return delay
+}
+
+// sleepCtx ждёт d и возвращает false, если ctx отменили раньше.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	select {
+	case <-clock.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// clockSkewTolerance — допуск на расхождение часов клиента и сервиса
+// (CLOCK_SKEW_TOLERANCE, по умолчанию 60s). Время, отстающее от текущего не
+// больше чем на допуск, не считается прошедшим.
+func clockSkewTolerance() time.Duration {
+	tol := getEnvDuration("CLOCK_SKEW_TOLERANCE", time.Minute)
+	if tol < 0 {
+		return 0
+	}
+	return tol
+}
+
+// scheduledWait возвращает время до run_at, если оно задано и ещё не наступило.
+// run_at в пределах допуска на расхождение часов считается «сейчас»:
+// расчёт выполняется сразу, без искусственной задержки.
+func scheduledWait(runAt string) (time.Duration, bool) {
+	if runAt == "" {
+		return 0, false
+	}
+	t, err := time.Parse(time.RFC3339, runAt)
+	if err != nil {
+		return 0, false
+	}
+	wait := t.Sub(clock.Now())
+	if wait <= 0 && -wait <= clockSkewTolerance() {
+		return 0, true
+	}
+	return wait, wait > 0
+}
+
+// waitWithHeartbeat ждёт d, вызывая beat каждые interval (если beat задан).
+// Возвращает false, если ctx отменили раньше.
+func waitWithHeartbeat(ctx context.Context, d, interval time.Duration, beat func()) bool {
+	if beat == nil || interval <= 0 {
+		return sleepCtx(ctx, d)
+	}
+	deadline := clock.Now().Add(d)
+	for {
+		left := deadline.Sub(clock.Now())
+		if left <= interval {
+			return sleepCtx(ctx, left)
+		}
+		if !sleepCtx(ctx, interval) {
+			return false
+		}
+		beat()
+	}
+}
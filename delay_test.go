@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// assertGolden сравнивает got с testdata/name; с -update перезаписывает файл.
+func assertGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("%s differs from golden file:\n%s", path, got)
+	}
+}
+
+func TestDeterministicCallbackGolden(t *testing.T) {
+	useDeterministic(t)
+	useStatusStore(t)
+	prev := callbackSender
+	ring := newCallbackRing(10)
+	callbackSender = ring
+	t.Cleanup(func() { callbackSender = prev })
+
+	var req calcRequest
+	body := `{
+		"calculation_id": 157,
+		"callback_url": "http://receiver/callback",
+		"start_date": "2025-01-01",
+		"end_date": "2026-01-01",
+		"currency": "EUR",
+		"include_breakdown": true,
+		"metadata": {"customer_id": "c-1"},
+		"services": [
+			{"id": 1, "price": 10, "price_type": "monthly", "quantity": 2, "category": "hosting"},
+			{"id": 2, "price": 99.9, "price_type": "one_time", "quantity": 1}
+		]
+	}`
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatal(err)
+	}
+	jobs.start(req)
+	handleAsync(context.Background(), req)
+
+	got, err := json.MarshalIndent(ring.list(), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertGolden(t, "deterministic_callback.json", append(got, '\n'))
+}
+
+func TestProcessingDelayDistributions(t *testing.T) {
+	t.Setenv("DELAY_DISTRIBUTION", "fixed")
+	t.Setenv("DELAY_MEAN", "3s")
+	for i := 0; i < 20; i++ {
+		if d := processingDelay(1); d != 3*time.Second {
+			t.Fatalf("fixed delay = %s, want 3s", d)
+		}
+	}
+
+	t.Setenv("DELAY_DISTRIBUTION", "uniform")
+	for i := 0; i < 50; i++ {
+		if d := processingDelay(1); d < 5*time.Second || d > 9*time.Second || d%time.Second != 0 {
+			t.Fatalf("uniform delay = %s, want whole seconds in [5s, 9s]", d)
+		}
+	}
+
+	// Отрицательная задержка нормального распределения обрезается до нуля
+	t.Setenv("DELAY_DISTRIBUTION", "normal")
+	t.Setenv("DELAY_MEAN", "0s")
+	for i := 0; i < 50; i++ {
+		if d := processingDelay(1); d < 0 {
+			t.Fatalf("normal delay = %s, want non-negative", d)
+		}
+	}
+}
+
+// delayHistogram — число наблюдений и сумма asynccalc_processing_delay_seconds.
+func delayHistogram(t *testing.T) (uint64, float64) {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range families {
+		if mf.GetName() == "asynccalc_processing_delay_seconds" {
+			h := mf.GetMetric()[0].GetHistogram()
+			return h.GetSampleCount(), h.GetSampleSum()
+		}
+	}
+	t.Fatal("asynccalc_processing_delay_seconds is not registered")
+	return 0, 0
+}
+
+func TestProcessingDelayIsObserved(t *testing.T) {
+	fc := useFakeClock(t)
+	useStatusStore(t)
+	t.Setenv("DELAY_DISTRIBUTION", "fixed")
+	t.Setenv("DELAY_MEAN", "2s")
+	t.Setenv("PROGRESS_STEPS", "0")
+	count, sum := delayHistogram(t)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runJob(context.Background(), calcRequest{CalculationID: 1})
+	}()
+	fc.waitForWaiters(t, 1)
+	fc.Advance(2 * time.Second)
+	<-done
+
+	newCount, newSum := delayHistogram(t)
+	if newCount != count+1 || newSum-sum != 2 {
+		t.Fatalf("histogram: %d samples (+%d), sum +%v; want one 2s sample", newCount, newCount-count, newSum-sum)
+	}
+}
+
+func TestScheduledWaitForRunAt(t *testing.T) {
+	fc := useFakeClock(t)
+	at := func(d time.Duration) string { return fc.Now().Add(d).Format(time.RFC3339) }
+
+	for _, tc := range []struct {
+		name      string
+		runAt     string
+		wait      time.Duration
+		scheduled bool
+	}{
+		{"near future", at(30 * time.Second), 30 * time.Second, true},
+		{"within clock skew", at(-30 * time.Second), 0, true},
+		{"long past", at(-2 * time.Minute), 0, false},
+		{"empty", "", 0, false},
+		{"malformed", "tomorrow", 0, false},
+	} {
+		// Без scheduled задержка не используется
+		wait, scheduled := scheduledWait(tc.runAt)
+		if scheduled != tc.scheduled || (scheduled && wait != tc.wait) {
+			t.Errorf("%s: wait %s, scheduled %t; want %s, %t", tc.name, wait, scheduled, tc.wait, tc.scheduled)
+		}
+	}
+
+	if err := validateRunAt(at(25 * time.Hour)); err == nil {
+		t.Error("run_at beyond RUN_AT_MAX_AHEAD accepted")
+	}
+	if err := validateRunAt(at(time.Hour)); err != nil {
+		t.Errorf("run_at in an hour: %v", err)
+	}
+}
+
+func TestRunJobWaitsForRunAt(t *testing.T) {
+	fc := useFakeClock(t)
+	useDeterministic(t)
+	useStatusStore(t)
+	t.Setenv("PROGRESS_STEPS", "0")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runJob(context.Background(), calcRequest{CalculationID: 1, RunAt: fc.Now().Add(30 * time.Second).Format(time.RFC3339)})
+	}()
+	fc.waitForWaiters(t, 1)
+	fc.Advance(29 * time.Second)
+	select {
+	case <-done:
+		t.Fatal("job ran before run_at")
+	case <-time.After(10 * time.Millisecond):
+	}
+	fc.Advance(time.Second)
+	<-done
+}
+
+func TestClockSkewBoundary(t *testing.T) {
+	fc := useFakeClock(t)
+	t.Setenv("CLOCK_SKEW_TOLERANCE", "60s")
+	at := func(d time.Duration) string { return fc.Now().Add(d).Format(time.RFC3339) }
+
+	// run_at в пределах допуска — «сейчас», за ним — прошедшее время
+	if _, scheduled := scheduledWait(at(-59 * time.Second)); !scheduled {
+		t.Error("run_at 59s ago is not treated as now")
+	}
+	if _, scheduled := scheduledWait(at(-61 * time.Second)); scheduled {
+		t.Error("run_at 61s ago is treated as now")
+	}
+
+	// Время подписи из будущего принимается в пределах допуска
+	t.Setenv("REQUEST_SIGNING_SECRET", "secret")
+	router := route(http.MethodPost, "/process", verifySignature, func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	for _, tc := range []struct {
+		ahead time.Duration
+		code  int
+	}{
+		{59 * time.Second, http.StatusNoContent},
+		{61 * time.Second, http.StatusUnauthorized},
+	} {
+		ts := fc.Now().Add(tc.ahead).Unix()
+		sig := hex.EncodeToString(signRequest("secret", ts, []byte(`{}`)))
+		rec := serve(router, http.MethodPost, "/process", `{}`, "X-Timestamp", strconv.FormatInt(ts, 10), "X-Signature", sig)
+		if rec.Code != tc.code {
+			t.Errorf("timestamp %s ahead: status %d, want %d", tc.ahead, rec.Code, tc.code)
+		}
+	}
+
+	// Для дат без времени допуск важен, только если он не меньше суток
+	if err := checkDates("2025-01-02", "2025-01-01"); err == nil {
+		t.Error("end_date a day before start_date accepted with 60s tolerance")
+	}
+	t.Setenv("CLOCK_SKEW_TOLERANCE", "24h")
+	if err := checkDates("2025-01-02", "2025-01-01"); err != nil {
+		t.Errorf("end_date a day before start_date with 24h tolerance: %v", err)
+	}
+}
+
+func TestDelayGrowsWithServices(t *testing.T) {
+	t.Setenv("DELAY_DISTRIBUTION", "fixed")
+	t.Setenv("DELAY_MEAN", "2s")
+	if d := processingDelay(10); d != 2*time.Second {
+		t.Fatalf("without DELAY_PER_SERVICE: %s, want 2s", d)
+	}
+
+	t.Setenv("DELAY_PER_SERVICE", "500ms")
+	small, large := processingDelay(2), processingDelay(10)
+	if small != 3*time.Second || large != 7*time.Second {
+		t.Fatalf("2 services: %s, 10 services: %s; want 3s and 7s", small, large)
+	}
+
+	t.Setenv("DELAY_MAX", "5s")
+	if d := processingDelay(10); d != 5*time.Second {
+		t.Fatalf("with DELAY_MAX: %s, want 5s", d)
+	}
+	if d := processingDelay(2); d != 3*time.Second {
+		t.Fatalf("under DELAY_MAX: %s, want 3s", d)
+	}
+}
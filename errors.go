@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIError — ошибка, которую все эндпоинты возвращают в едином виде:
+// {"error":{"code":"...","message":"..."}}.
+type APIError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// writeError отправляет ошибку и прерывает цепочку обработчиков.
+func writeError(c *gin.Context, err *APIError) {
+	c.AbortWithStatusJSON(err.Status, gin.H{"error": err})
+}
+
+func errUnauthorized() *APIError {
+	return &APIError{Status: http.StatusForbidden, Code: "unauthorized", Message: "unauthorized"}
+}
+
+func errInvalidSignature(message string) *APIError {
+	return &APIError{Status: http.StatusUnauthorized, Code: "invalid_signature", Message: message}
+}
+
+func errBadRequest(message string) *APIError {
+	return &APIError{Status: http.StatusBadRequest, Code: "bad_request", Message: message}
+}
+
+func errValidation(message string) *APIError {
+	return &APIError{Status: http.StatusBadRequest, Code: "validation_failed", Message: message}
+}
+
+func errUnsupportedMediaType(message string) *APIError {
+	return &APIError{Status: http.StatusUnsupportedMediaType, Code: "unsupported_media_type", Message: message}
+}
+
+func errConflict(message string) *APIError {
+	return &APIError{Status: http.StatusConflict, Code: "conflict", Message: message}
+}
+
+func errNotFound(message string) *APIError {
+	return &APIError{Status: http.StatusNotFound, Code: "not_found", Message: message}
+}
+
+func errTooManyRequests(message string) *APIError {
+	return &APIError{Status: http.StatusTooManyRequests, Code: "rate_limited", Message: message}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// estimateRequest — оценка стоимости, когда точные даты неизвестны:
+// период задаётся границами в месяцах.
+type estimateRequest struct {
+	Services              []serviceItem `json:"services" binding:"required,min=1,dive"`
+	MinMonths             int           `json:"min_months" binding:"required,min=1"`
+	MaxMonths             int           `json:"max_months" binding:"required,min=1"`
+	Currency              string        `json:"currency,omitempty"`
+	AnnualIncreasePercent float64       `json:"annual_increase_percent,omitempty" binding:"omitempty,min=0,max=100"`
+}
+
+// estimateBound — стоимость на одной из границ периода.
+type estimateBound struct {
+	TotalCost      float64 `json:"total_cost"`
+	DurationMonths int     `json:"duration_months"`
+}
+
+type estimateResult struct {
+	Currency string        `json:"currency"`
+	Min      estimateBound `json:"min"`
+	Max      estimateBound `json:"max"`
+}
+
+// estimateHandler синхронно считает стоимость на минимальном и максимальном
+// периоде, без колбэка и случайного исхода.
+func estimateHandler(c *gin.Context) {
+	if !isJSONContentType(c.GetHeader("Content-Type")) {
+		writeError(c, errUnsupportedMediaType("content type must be application/json"))
+		return
+	}
+
+	var req estimateRequest
+	if err := bindJSON(c, &req); err != nil {
+		writeError(c, err)
+		return
+	}
+	if req.MinMonths > req.MaxMonths {
+		writeError(c, errValidation("min_months must not exceed max_months"))
+		return
+	}
+	for _, it := range req.Services {
+		if err := validateService(it); err != nil {
+			writeError(c, errValidation(fmt.Sprintf("service %d: %v", it.ID, err)))
+			return
+		}
+	}
+
+	currency := normalizeCurrency(req.Currency)
+	if currency == "" {
+		currency = defaultCurrency
+	}
+	opts := calcOptions{AnnualIncreasePercent: req.AnnualIncreasePercent}
+	bound := func(months int) estimateBound {
+		out := calculate(req.Services, &months, opts)
+		return estimateBound{
+			TotalCost:      roundTo(out.Total, currencyPrecision(currency)),
+			DurationMonths: out.DurationMonths,
+		}
+	}
+	res := estimateResult{Currency: currency, Min: bound(req.MinMonths), Max: bound(req.MaxMonths)}
+	if limit := getEnvFloat("MAX_TOTAL_COST", 0); limit > 0 && res.Max.TotalCost > limit {
+		writeError(c, errValidation(fmt.Sprintf("total_cost exceeds the allowed maximum of %v", limit)))
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestEstimateBounds(t *testing.T) {
+	router := route(http.MethodPost, "/estimate", estimateHandler)
+	services := `"services": [
+		{"id": 1, "price": 100, "price_type": "monthly", "quantity": 2},
+		{"id": 2, "price": 50, "price_type": "one_time", "quantity": 1}
+	]`
+
+	rec := serve(router, http.MethodPost, "/estimate", `{`+services+`, "min_months": 6, "max_months": 24, "annual_increase_percent": 10}`, "Content-Type", "application/json")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var res estimateResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Min.TotalCost > res.Max.TotalCost {
+		t.Fatalf("min %v exceeds max %v", res.Min.TotalCost, res.Max.TotalCost)
+	}
+	if res.Min.TotalCost != 1250 || res.Min.DurationMonths != 6 || res.Max.TotalCost != 5090 || res.Max.DurationMonths != 24 {
+		t.Fatalf("estimate = %+v", res)
+	}
+
+	rec = serve(router, http.MethodPost, "/estimate", `{`+services+`, "min_months": 12, "max_months": 6}`, "Content-Type", "application/json")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("min_months > max_months: status %d, want 400", rec.Code)
+	}
+}
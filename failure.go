@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Симуляция неуспеха. По умолчанию неуспех с вероятностью
+// SIMULATE_FAILURE_RATE (0.5). FAILURE_RULES задаёт правила вида
+// "total_cost>100000:0.8,services>=10:0.7": первое подходящее правило
+// определяет вероятность неуспеха вместо общей.
+var (
+	failureRate  = 0.5
+	failureRules []failureRule
+)
+
+// requestFeatures — признаки заявки, от которых могут зависеть правила.
+type requestFeatures struct {
+	TotalCost      float64
+	Services       int
+	DurationMonths int
+}
+
+type failureRule struct {
+	feature     string
+	op          string
+	threshold   float64
+	probability float64
+}
+
+func (r failureRule) matches(f requestFeatures) bool {
+	var v float64
+	switch r.feature {
+	case "total_cost":
+		v = f.TotalCost
+	case "services":
+		v = float64(f.Services)
+	case "duration_months":
+		v = float64(f.DurationMonths)
+	}
+	switch r.op {
+	case ">":
+		return v > r.threshold
+	case ">=":
+		return v >= r.threshold
+	case "<":
+		return v < r.threshold
+	case "<=":
+		return v <= r.threshold
+	}
+	return false
+}
+
+// failureProbability возвращает вероятность неуспеха для заявки.
+func failureProbability(f requestFeatures) float64 {
+	for _, r := range failureRules {
+		if r.matches(f) {
+			return r.probability
+		}
+	}
+	return failureRate
+}
+
+// parseFailureRules разбирает FAILURE_RULES.
+func parseFailureRules(value string) ([]failureRule, error) {
+	var rules []failureRule
+	for _, item := range splitList(value) {
+		cond, probStr, ok := strings.Cut(item, ":")
+		if !ok {
+			return nil, fmt.Errorf("rule %q: missing probability", item)
+		}
+		prob, err := parseProbability(probStr)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", item, err)
+		}
+		rule := failureRule{probability: prob}
+		// Двухсимвольные операторы проверяем раньше односимвольных
+		for _, op := range []string{">=", "<=", ">", "<"} {
+			if feature, threshold, found := strings.Cut(cond, op); found {
+				rule.feature, rule.op = strings.TrimSpace(feature), op
+				rule.threshold, err = strconv.ParseFloat(strings.TrimSpace(threshold), 64)
+				if err != nil {
+					return nil, fmt.Errorf("rule %q: invalid threshold", item)
+				}
+				break
+			}
+		}
+		switch rule.feature {
+		case "total_cost", "services", "duration_months":
+		default:
+			return nil, fmt.Errorf("rule %q: unknown feature %q", item, rule.feature)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func parseProbability(value string) (float64, error) {
+	p, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || p < 0 || p > 1 {
+		return 0, errors.New("probability must be between 0 and 1")
+	}
+	return p, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+func TestFailureProbabilityFollowsRules(t *testing.T) {
+	rules, err := parseFailureRules("total_cost>100000:0.8, services>=10:0.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	swap(t, &failureRules, rules)
+	swap(t, &failureRate, 0.1)
+
+	cases := []struct {
+		name string
+		f    requestFeatures
+		want float64
+	}{
+		{"expensive", requestFeatures{TotalCost: 200000, Services: 12}, 0.8},
+		{"many services", requestFeatures{TotalCost: 100000, Services: 10}, 0.7},
+		{"no rule", requestFeatures{TotalCost: 500, Services: 2}, 0.1},
+	}
+	for _, tc := range cases {
+		if got := failureProbability(tc.f); got != tc.want {
+			t.Errorf("%s: probability %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	// Правило с вероятностью 1 проваливает заявку, остальные проходят
+	swap(t, &failureRules, []failureRule{{feature: "services", op: ">=", threshold: 2, probability: 1}})
+	swap(t, &failureRate, 0.0)
+	one := []serviceItem{{ID: 1, Price: 10, PriceType: "monthly", Quantity: 1}}
+	two := append(one, serviceItem{ID: 2, Price: 10, PriceType: "monthly", Quantity: 1})
+	if got := computeResult(calcRequest{CalculationID: 1, Services: one}).Status; got != "success" {
+		t.Errorf("one service: status %q, want success", got)
+	}
+	if got := computeResult(calcRequest{CalculationID: 2, Services: two}).Status; got != "failure" {
+		t.Errorf("two services: status %q, want failure", got)
+	}
+}
+
+func TestParseFailureRulesRejectsInvalid(t *testing.T) {
+	for _, value := range []string{
+		"total_cost>100",
+		"total_cost>100:1.5",
+		"total_cost>abc:0.5",
+		"weight>10:0.5",
+	} {
+		if _, err := parseFailureRules(value); err == nil {
+			t.Errorf("%q: expected an error", value)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// maxIdempotencyKeyLen — предельная длина заголовка Idempotency-Key.
+const maxIdempotencyKeyLen = 255
+
+// idempotentResults хранит первый результат заявки с Idempotency-Key:
+// повтор (в том числе POST /process/:id/replay) получает его же, а не
+// новый расчёт с новым случайным исходом. Инициализируется в main.
+var idempotentResults = newResultStore(24 * time.Hour)
+
+// resultStore — результаты по ключу идемпотентности, живут ttl.
+type resultStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	results map[string]storedResult
+}
+
+// storedResult — запись по ключу: хеш заявки, занявшей ключ (requestHash),
+// и её результат, когда он готов.
+type storedResult struct {
+	hash     string
+	result   calcResult
+	done     bool
+	storedAt time.Time
+}
+
+func newResultStore(ttl time.Duration) *resultStore {
+	return &resultStore{ttl: ttl, results: map[string]storedResult{}}
+}
+
+// claim закрепляет ключ за заявкой с хешем hash при её приёме. Возвращает
+// false, если ключ уже занят другой заявкой: иначе она получила бы чужой
+// результат с чужими calculation_id и metadata.
+func (s *resultStore) claim(key, hash string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stored, ok := s.results[key]; ok && clock.Now().Sub(stored.storedAt) < s.ttl {
+		return stored.hash == hash
+	}
+	s.results[key] = storedResult{hash: hash, storedAt: clock.Now()}
+	return true
+}
+
+// get возвращает сохранённый результат, если он уже есть и ещё не устарел.
+func (s *resultStore) get(key string) (calcResult, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.results[key]
+	if !ok {
+		return calcResult{}, false
+	}
+	if clock.Now().Sub(stored.storedAt) >= s.ttl {
+		delete(s.results, key)
+		return calcResult{}, false
+	}
+	return stored.result, stored.done
+}
+
+// putIfAbsent сохраняет результат, если по ключу ещё ничего нет, и
+// возвращает тот, что в итоге хранится: две одновременные заявки с одним
+// ключом получат одинаковый ответ.
+func (s *resultStore) putIfAbsent(key string, result calcResult) calcResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.results[key]
+	if ok && stored.done && clock.Now().Sub(stored.storedAt) < s.ttl {
+		return stored.result
+	}
+	s.results[key] = storedResult{hash: stored.hash, result: result, done: true, storedAt: clock.Now()}
+	return result
+}
+
+func (s *resultStore) sweep(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := 0
+	for key, stored := range s.results {
+		if now.Sub(stored.storedAt) >= s.ttl {
+			delete(s.results, key)
+			removed++
+		}
+	}
+	return removed
+}
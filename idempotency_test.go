@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyKeyReturnsSameResult(t *testing.T) {
+	useStatusStore(t)
+	fs := useFakeSender(t)
+	swap(t, &idempotentResults, newResultStore(time.Hour))
+	t.Setenv("DELAY_DISTRIBUTION", "fixed")
+	t.Setenv("DELAY_MEAN", "0s")
+	router := route(http.MethodPost, "/process", processHandler)
+	post := func(body string) int {
+		return serve(router, http.MethodPost, "/process", body, "Content-Type", "application/json", "Idempotency-Key", "order-17").Code
+	}
+	body := `{"calculation_id": 17, "callback_url": "http://receiver", "services": [{"id": 1, "price": 10, "price_type": "monthly", "quantity": 1}]}`
+
+	// Первый исход — неуспех; повтор с тем же ключом получает его же,
+	// хотя теперь расчёт был бы успешным
+	swap(t, &failureRate, 1.0)
+	if code := post(body); code != http.StatusAccepted {
+		t.Fatalf("first request: status %d", code)
+	}
+	waitDelivered(t, 17)
+	failureRate = 0
+	if code := post(body); code != http.StatusAccepted {
+		t.Fatalf("repeated request: status %d", code)
+	}
+	waitDelivered(t, 17)
+
+	sent := fs.delivered()
+	if len(sent) != 2 || string(sent[0].Payload) != string(sent[1].Payload) || decodeResult(t, sent[1]).Status != "failure" {
+		t.Fatalf("callbacks = %+v, want the first result twice", sent)
+	}
+
+	// Тот же ключ с другой заявкой — конфликт, а не чужой результат
+	other := `{"calculation_id": 18, "callback_url": "http://receiver", "services": []}`
+	if code := post(other); code != http.StatusConflict {
+		t.Fatalf("key reused for another request: status %d, want 409", code)
+	}
+}
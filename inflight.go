@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// inflight — счётчики текущей работы для GET /admin/inflight: лёгкая
+// замена метрикам, когда нужен только «что происходит сейчас».
+var inflight struct {
+	// running — выполняющиеся runJob: одиночные заявки, повторы и элементы
+	// пакетов.
+	running atomic.Int64
+	// queued — заявки в очереди пулов обработчиков.
+	queued atomic.Int64
+	// retrying — колбэки, ожидающие повторной попытки.
+	retrying atomic.Int64
+}
+
+// inflightHandler возвращает текущие значения счётчиков inflight.
+func inflightHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"running":         inflight.running.Load(),
+		"queued":          inflight.queued.Load(),
+		"pending_retries": inflight.retrying.Load(),
+	})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestInflightCounts(t *testing.T) {
+	fc := useFakeClock(t)
+	useStatusStore(t)
+	fs := useFakeSender(t)
+	swap(t, &failureRate, 0.0)
+	swap(t, &pendingJobs, newJobRegistry())
+	useWorkerPool(t, 1)
+	t.Setenv("DELAY_DISTRIBUTION", "fixed")
+	t.Setenv("DELAY_MEAN", "10s")
+	t.Setenv("PROGRESS_STEPS", "0")
+	router := route(http.MethodGet, "/admin/inflight", inflightHandler)
+	counts := func() string {
+		return serve(router, http.MethodGet, "/admin/inflight", "").Body.String()
+	}
+
+	// Первая попытка колбэка не удаётся; вторая видит себя среди повторов
+	retrying := make(chan int64, 1)
+	fs.fail = func(_ string, n int) error {
+		if n == 1 {
+			return errors.New("connection refused")
+		}
+		retrying <- inflight.retrying.Load()
+		return nil
+	}
+
+	// Группа batch_callbacks вызывает runJob напрямую, минуя handleAsync
+	body := `{"batch_callbacks": true, "calculations": [
+		{"calculation_id": 1, "callback_url": "http://receiver", "services": []},
+		{"calculation_id": 2, "callback_url": "http://receiver", "services": []}
+	]}`
+	rec := serve(route(http.MethodPost, "/process/batch", batchHandler), http.MethodPost, "/process/batch", body, "Content-Type", "application/json")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("batch: status %d: %s", rec.Code, rec.Body)
+	}
+	fc.waitForWaiters(t, 1)
+	if got := counts(); got != `{"pending_retries":0,"queued":1,"running":1}` {
+		t.Fatalf("one running, one queued: %s", got)
+	}
+
+	fc.Advance(10 * time.Second)
+	fc.waitForWaiters(t, 1)
+	if got := counts(); got != `{"pending_retries":0,"queued":0,"running":1}` {
+		t.Fatalf("second job running: %s", got)
+	}
+
+	fc.Advance(10 * time.Second)
+	if n := <-retrying; n != 1 {
+		t.Fatalf("pending_retries during the retry = %d, want 1", n)
+	}
+	eventually(t, func() bool { return counts() == `{"pending_retries":0,"queued":0,"running":0}` })
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// sweeper — хранилище в памяти с записями, у которых истекает срок.
+type sweeper interface {
+	// sweep удаляет записи, истёкшие к now, и возвращает их число.
+	sweep(now time.Time) int
+}
+
+// runJanitor раз в interval (JANITOR_INTERVAL) вычищает истёкшие записи из
+// всех хранилищ одной горутиной вместо отдельного таймера на каждое.
+// Останавливается с отменой ctx.
+func runJanitor(ctx context.Context, interval time.Duration, stores ...sweeper) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-clock.After(interval):
+		}
+		now := clock.Now()
+		removed := 0
+		for _, s := range stores {
+			removed += s.sweep(now)
+		}
+		if removed > 0 {
+			log.Printf("janitor removed %d expired entries", removed)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestJanitorExpiresEntries(t *testing.T) {
+	fc := useFakeClock(t)
+	store := useStatusStore(t)
+	store.ttl = time.Hour
+	results := newResultStore(time.Hour)
+	dedup := newDedupStore(45*time.Minute, 0)
+
+	store.start(calcRequest{CalculationID: 1})
+	store.finish(1, calcResult{CalculationID: 1, Status: "success"})
+	store.start(calcRequest{CalculationID: 2})
+	results.claim("key", "hash")
+	dedup.seen("hash")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runJanitor(ctx, time.Minute, store, results, dedup)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	// tick переводит часы и ждёт, пока janitor закончит проход и снова уснёт
+	tick := func(d time.Duration) {
+		fc.waitForWaiters(t, 1)
+		fc.Advance(d)
+		fc.waitForWaiters(t, 1)
+	}
+
+	tick(30 * time.Minute)
+	if _, ok := store.get(1); !ok {
+		t.Fatal("finished job removed before STATUS_TTL")
+	}
+	if !dedup.seen("hash") {
+		t.Fatal("dedup entry within its window was removed")
+	}
+
+	// Через час все записи, кроме ожидающей заявки, устарели
+	tick(30 * time.Minute)
+	if _, ok := store.get(1); ok {
+		t.Error("finished job kept after STATUS_TTL")
+	}
+	if _, ok := store.get(2); !ok {
+		t.Error("pending job removed")
+	}
+	if !results.claim("key", "other-hash") {
+		t.Error("idempotency key kept after its TTL")
+	}
+	if dedup.seen("hash") {
+		t.Error("dedup entry kept after its window")
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// processingDelaySeconds — фактические искусственные задержки handleAsync,
+	// чтобы сверять распределение с DELAY_DISTRIBUTION.
+	processingDelaySeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "asynccalc_processing_delay_seconds",
+		Help:    "Artificial processing delay applied to each calculation.",
+		Buckets: []float64{0.5, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 15, 30},
+	})
+
+	// inFlightJobs — заявки, которые сейчас обрабатываются в handleAsync.
+	inFlightJobs = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "asynccalc_in_flight_jobs",
+		Help: "Calculations currently being processed.",
+	})
+
+	// quantityDefaultedRequests — заявки, где quantity подставлен у доли строк
+	// больше QUANTITY_DEFAULT_WARN_FRACTION.
+	quantityDefaultedRequests = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "asynccalc_quantity_defaulted_requests_total",
+		Help: "Calculations where too many services had their quantity defaulted to 1.",
+	})
+)
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+)
+
+// workers — пул обработчиков заявок (WORKER_POOL_SIZE). При nil каждая
+// заявка обрабатывается в своей горутине, как без пула.
+var workers *workerPool
+
+// batchWorkers — отдельный пул для заявок из /process/batch и
+// /process/batch/stream (BATCH_WORKERS), чтобы большой пакет не занимал
+// обработчики одиночных заявок. При nil пакеты идут в workers.
+var batchWorkers *workerPool
+
+// batchPool возвращает пул для заявок пакета.
+func batchPool() *workerPool {
+	if batchWorkers != nil {
+		return batchWorkers
+	}
+	return workers
+}
+
+// priorityRank переводит priority заявки в порядок очереди: чем больше,
+// тем раньше. Пустое значение — normal.
+func priorityRank(priority string) int {
+	switch priority {
+	case "high":
+		return 2
+	case "low":
+		return 0
+	default:
+		return 1
+	}
+}
+
+// queuedJob — заявка, ожидающая свободного обработчика.
+type queuedJob struct {
+	rank int
+	seq  uint64
+	// ctx отслеживается в pendingJobs, пока заявка стоит в очереди.
+	ctx     context.Context
+	parent  context.Context
+	untrack func()
+	run     func(context.Context)
+}
+
+// jobQueue — куча по приоритету, внутри приоритета — по порядку поступления.
+type jobQueue []*queuedJob
+
+func (q jobQueue) Len() int { return len(q) }
+func (q jobQueue) Less(i, j int) bool {
+	if q[i].rank != q[j].rank {
+		return q[i].rank > q[j].rank
+	}
+	return q[i].seq < q[j].seq
+}
+func (q jobQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *jobQueue) Push(x any)   { *q = append(*q, x.(*queuedJob)) }
+func (q *jobQueue) Pop() any {
+	old := *q
+	job := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return job
+}
+
+// workerPool — фиксированное число обработчиков, которые берут заявки из
+// общей приоритетной очереди.
+type workerPool struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	queue jobQueue
+	seq   uint64
+}
+
+func newWorkerPool(size int) *workerPool {
+	p := &workerPool{}
+	p.cond = sync.NewCond(&p.mu)
+	for i := 0; i < size; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// submit ставит заявку в очередь. Без пула run сразу запускается в горутине.
+func (p *workerPool) submit(ctx context.Context, priority string, run func(context.Context)) {
+	if p == nil {
+		go run(ctx)
+		return
+	}
+	// Заявка в очереди тоже считается ожидающей для POST /admin/cancel-all
+	jobCtx, untrack := pendingJobs.track(ctx)
+	inflight.queued.Add(1)
+	p.mu.Lock()
+	p.seq++
+	heap.Push(&p.queue, &queuedJob{
+		rank:    priorityRank(priority),
+		seq:     p.seq,
+		ctx:     jobCtx,
+		parent:  ctx,
+		untrack: untrack,
+		run:     run,
+	})
+	p.mu.Unlock()
+	p.cond.Signal()
+}
+
+func (p *workerPool) work() {
+	for {
+		p.mu.Lock()
+		for len(p.queue) == 0 {
+			p.cond.Wait()
+		}
+		job := heap.Pop(&p.queue).(*queuedJob)
+		p.mu.Unlock()
+		inflight.queued.Add(-1)
+
+		// Отменённая в очереди заявка получает отменённый контекст и сразу
+		// завершается как cancelled; остальные дальше отслеживает runJob
+		ctx := job.parent
+		if job.ctx.Err() != nil {
+			ctx = job.ctx
+		}
+		job.untrack()
+		job.run(ctx)
+	}
+}
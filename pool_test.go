@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestHighPriorityRunsFirst(t *testing.T) {
+	swap(t, &pendingJobs, newJobRegistry())
+	pool := newWorkerPool(1)
+
+	// Единственный обработчик занят, пока заявки копятся в очереди
+	release := make(chan struct{})
+	pool.submit(context.Background(), "", func(context.Context) { <-release })
+
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	for _, priority := range []string{"low", "normal", "high", "", "high"} {
+		wg.Add(1)
+		pool.submit(context.Background(), priority, func(context.Context) {
+			defer wg.Done()
+			mu.Lock()
+			order = append(order, priority)
+			mu.Unlock()
+		})
+	}
+	close(release)
+	wg.Wait()
+
+	want := []string{"high", "high", "normal", "", "low"}
+	if !reflect.DeepEqual(order, want) {
+		t.Fatalf("run order = %q, want %q", order, want)
+	}
+}
+
+func TestBlockedReceiverDoesNotStallPool(t *testing.T) {
+	useDeterministic(t)
+	useStatusStore(t)
+	useWorkerPool(t, 1)
+	release := make(chan struct{})
+	swap[CallbackSender](t, &callbackSender, senderFunc(func(_ context.Context, url string, _ []byte) error {
+		if url == "http://stuck" {
+			<-release
+		}
+		return nil
+	}))
+
+	// Доставка первой заявки висит, но обработчик уже свободен для второй
+	for i, url := range []string{"http://stuck", "http://receiver"} {
+		req := calcRequest{CalculationID: i + 1, CallbackURL: url, Services: []serviceItem{}}
+		jobs.start(req)
+		scheduleAsync(context.Background(), workers, req)
+	}
+	waitDelivered(t, 2)
+	if status, _ := jobs.get(1); status.DeliveredTo != "" {
+		t.Fatalf("calculation 1 delivered to %q while the receiver is blocked", status.DeliveredTo)
+	}
+
+	close(release)
+	waitDelivered(t, 1)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// processLimiter — общий для всех клиентов предел частоты POST /process
+// (PROCESS_RATE_LIMIT запросов в секунду, всплеск PROCESS_RATE_BURST).
+// При nil частота не ограничена. Инициализируется в main.
+var processLimiter *tokenBucket
+
+// tokenBucket — ведро токенов: пополняется со скоростью rate в секунду до
+// burst, каждый запрос забирает один токен.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = int(math.Ceil(rate))
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: clock.Now()}
+}
+
+// allow забирает токен, если он есть.
+func (b *tokenBucket) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := clock.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// globalRateLimit отвечает 429, когда общий предел processLimiter исчерпан,
+// независимо от токена клиента. Стоит после serviceAuth, чтобы запросы без
+// токена не расходовали общий предел.
+func globalRateLimit(c *gin.Context) {
+	if processLimiter != nil && !processLimiter.allow() {
+		c.Header("Retry-After", "1")
+		writeError(c, errTooManyRequests("rate limit exceeded"))
+		return
+	}
+	c.Next()
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGlobalRateLimitThrottles(t *testing.T) {
+	fc := useFakeClock(t)
+	swap(t, &processLimiter, newTokenBucket(1, 2))
+	router := route(http.MethodPost, "/process", serviceAuth, globalRateLimit, func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	send := func(token string) (int, string) {
+		rec := serve(router, http.MethodPost, "/process", `{}`, "X-ASYNC-TOKEN", token)
+		return rec.Code, rec.Header().Get("Retry-After")
+	}
+
+	// Запросы без верного токена общий предел не расходуют
+	for i := 0; i < 5; i++ {
+		if code, _ := send("wrong"); code != http.StatusForbidden {
+			t.Fatalf("wrong token: status %d, want 403", code)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if code, _ := send("async-secret"); code != http.StatusNoContent {
+			t.Fatalf("request %d within burst: status %d", i+1, code)
+		}
+	}
+	if code, retryAfter := send("async-secret"); code != http.StatusTooManyRequests || retryAfter != "1" {
+		t.Fatalf("over the limit: status %d, Retry-After %q", code, retryAfter)
+	}
+
+	fc.Advance(time.Second)
+	if code, _ := send("async-secret"); code != http.StatusNoContent {
+		t.Fatalf("after refill: status %d", code)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// refundRequest — запрос расчёта возврата при досрочном расторжении.
+type refundRequest struct {
+	Services     []serviceItem `json:"services" binding:"dive"`
+	StartDate    string        `json:"start_date" binding:"required,dateonly"`
+	EndDate      string        `json:"end_date" binding:"required,dateonly"`
+	TerminatedAt string        `json:"terminated_at" binding:"required,dateonly"`
+	Currency     string        `json:"currency,omitempty"`
+	// Proration — как делить стоимость: monthly (по умолчанию) — по
+	// оплачиваемым месяцам, daily — по точному числу дней.
+	Proration string `json:"proration,omitempty" binding:"omitempty,oneof=monthly daily"`
+}
+
+type refundResult struct {
+	Refund          float64 `json:"refund"`
+	Currency        string  `json:"currency"`
+	TotalMonths     int     `json:"total_months"`
+	ConsumedMonths  int     `json:"consumed_months"`
+	RemainingMonths int     `json:"remaining_months"`
+	// Дни периода — только при proration=daily.
+	TotalDays     *int `json:"total_days,omitempty"`
+	ConsumedDays  *int `json:"consumed_days,omitempty"`
+	RemainingDays *int `json:"remaining_days,omitempty"`
+}
+
+// refundHandler считает неиспользованную часть периодических услуг как кредит.
+// Разовые услуги не возвращаются; расторжение после end_date даёт нулевой возврат.
+func refundHandler(c *gin.Context) {
+	if !isJSONContentType(c.GetHeader("Content-Type")) {
+		writeError(c, errUnsupportedMediaType("content type must be application/json"))
+		return
+	}
+
+	var req refundRequest
+	if err := bindJSON(c, &req); err != nil {
+		writeError(c, err)
+		return
+	}
+	if err := checkDates(req.StartDate, req.EndDate); err != nil {
+		writeError(c, errValidation(err.Error()))
+		return
+	}
+	for _, it := range req.Services {
+		if err := validateService(it); err != nil {
+			writeError(c, errValidation(fmt.Sprintf("service %d: %v", it.ID, err)))
+			return
+		}
+	}
+
+	start, _ := parseDateOnly(req.StartDate)
+	end, _ := parseDateOnly(req.EndDate)
+	terminated, _ := parseDateOnly(req.TerminatedAt)
+
+	currency := normalizeCurrency(req.Currency)
+	if currency == "" {
+		currency = defaultCurrency
+	}
+	c.JSON(http.StatusOK, computeRefund(req.Services, start, end, terminated, currency, req.Proration == "daily"))
+}
+
+// computeRefund возвращает неиспользованную долю периодических услуг: по
+// месяцам или, при daily, по дням — точнее для коротких договоров.
+func computeRefund(items []serviceItem, start, end, terminated time.Time, currency string, daily bool) refundResult {
+	total := *durationFromDates(start, end, 0, "")
+	res := refundResult{Currency: currency, TotalMonths: total, ConsumedMonths: total}
+	// Нулевой период (sameDayZeroDuration) возвращать нечего
+	if total == 0 || !terminated.Before(end) {
+		return res
+	}
+
+	consumed := 0
+	if terminated.After(start) {
+		consumed = *durationFromDates(start, terminated, 0, "")
+	}
+	if consumed > total {
+		consumed = total
+	}
+	res.ConsumedMonths = consumed
+	res.RemainingMonths = total - consumed
+
+	// Доля к возврату: оставшиеся месяцы (или дни) от всего периода
+	share := float64(res.RemainingMonths) / float64(total)
+	totalDays := *daysBetween(start, end)
+	if daily && totalDays > 0 {
+		consumedDays := min(*daysBetween(start, terminated), totalDays)
+		remainingDays := totalDays - consumedDays
+		res.TotalDays, res.ConsumedDays, res.RemainingDays = &totalDays, &consumedDays, &remainingDays
+		share = float64(remainingDays) / float64(totalDays)
+	}
+
+	var refund float64
+	for _, it := range items {
+		if it.Quantity <= 0 && quantityZeroPolicy == "default-to-1" {
+			it.Quantity = 1
+		}
+		cost, recurring := lineCost(it, period{Months: total, Days: totalDays})
+		if !recurring {
+			continue
+		}
+		refund += cost * share
+	}
+	res.Refund = roundTo(refund, currencyPrecision(currency))
+	return res
+}
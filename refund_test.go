@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// postRefund вызывает POST /refund и разбирает ответ.
+func postRefund(t *testing.T, body string) refundResult {
+	t.Helper()
+	rec := serve(route(http.MethodPost, "/refund", refundHandler), http.MethodPost, "/refund", body, "Content-Type", "application/json")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /refund: status %d: %s", rec.Code, rec.Body)
+	}
+	var res refundResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestRefundOnEarlyTermination(t *testing.T) {
+	services := `"services": [
+		{"id": 1, "price": 100, "price_type": "monthly", "quantity": 1},
+		{"id": 2, "price": 50, "price_type": "one_time", "quantity": 1}
+	]`
+
+	// Расторжение через 3 месяца из 12: возвращается 9/12 периодической
+	// услуги, разовая не возвращается
+	res := postRefund(t, `{`+services+`, "start_date": "2025-01-01", "end_date": "2026-01-01", "terminated_at": "2025-04-01"}`)
+	if res.Refund != 900 || res.TotalMonths != 12 || res.ConsumedMonths != 3 || res.RemainingMonths != 9 {
+		t.Fatalf("mid-term refund = %+v, want 900 for 9 of 12 months", res)
+	}
+
+	res = postRefund(t, `{`+services+`, "start_date": "2025-01-01", "end_date": "2026-01-01", "terminated_at": "2026-02-01"}`)
+	if res.Refund != 0 || res.RemainingMonths != 0 || res.ConsumedMonths != 12 {
+		t.Fatalf("post-term refund = %+v, want zero", res)
+	}
+}
+
+func TestRefundDailyVsMonthly(t *testing.T) {
+	// 15 дней из 59: помесячно неполный месяц считается использованным
+	body := `{"services": [{"id": 1, "price": 100, "price_type": "monthly", "quantity": 1}],
+		"start_date": "2025-01-01", "end_date": "2025-03-01", "terminated_at": "2025-01-16"`
+
+	res := postRefund(t, body+`}`)
+	if res.Refund != 100 || res.RemainingMonths != 1 || res.TotalDays != nil {
+		t.Fatalf("monthly proration = %+v, want 100 for 1 of 2 months", res)
+	}
+
+	res = postRefund(t, body+`, "proration": "daily"}`)
+	if res.Refund != 149.15 || res.TotalDays == nil || *res.TotalDays != 59 || *res.ConsumedDays != 15 || *res.RemainingDays != 44 {
+		t.Fatalf("daily proration = %+v, want 149.15 for 44 of 59 days", res)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// pendingRetries — очередь повторов колбэков на диске (CALLBACK_RETRY_FILE),
+// чтобы повторы пережили перезапуск во время недоступности получателя.
+// При nil повторы живут только в памяти. Инициализируется в main.
+var pendingRetries *retryStore
+
+// retryEntry — колбэк, ожидающий следующей попытки.
+type retryEntry struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// FallbackURL — куда отправить, когда попытки на URL исчерпаны.
+	FallbackURL string `json:"fallback_url,omitempty"`
+	// Body — тело колбэка как есть (в файле — base64).
+	Body []byte `json:"body"`
+	// Attempt — число уже сделанных попыток.
+	Attempt int `json:"attempt"`
+	// Backoff — задержка, которая будет после следующей неудачи.
+	Backoff time.Duration `json:"backoff"`
+	NextAt  time.Time     `json:"next_at"`
+	// Limits — таймаут и повторы, заданные заявкой.
+	Limits callbackLimits `json:"limits"`
+	// Gzip — получатель принимает сжатое тело (см. withCallbackGzip).
+	Gzip bool `json:"gzip,omitempty"`
+}
+
+// retryStore держит очередь в памяти и переписывает файл целиком при каждом
+// изменении: очередь мала, а запись через временный файл и rename не
+// оставляет на диске наполовину записанный JSON.
+type retryStore struct {
+	mu      sync.Mutex
+	path    string
+	seq     int
+	entries map[string]retryEntry
+}
+
+// loadRetryStore читает очередь из файла; отсутствующий файл — пустая очередь.
+func loadRetryStore(path string) (*retryStore, error) {
+	s := &retryStore{path: path, entries: map[string]retryEntry{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []retryEntry
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, e := range list {
+		s.entries[e.ID] = e
+	}
+	return s, nil
+}
+
+// newID возвращает идентификатор новой записи.
+func (s *retryStore) newID() string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	return strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + strconv.Itoa(s.seq)
+}
+
+// save добавляет или обновляет запись.
+func (s *retryStore) save(e retryEntry) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[e.ID] = e
+	s.flush()
+}
+
+// remove убирает запись после успешной доставки или последней попытки.
+func (s *retryStore) remove(id string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[id]; !ok {
+		return
+	}
+	delete(s.entries, id)
+	s.flush()
+}
+
+// list возвращает копию очереди.
+func (s *retryStore) list() []retryEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]retryEntry, 0, len(s.entries))
+	for _, e := range s.entries {
+		list = append(list, e)
+	}
+	return list
+}
+
+// flush записывает очередь в файл. Вызывается под s.mu.
+func (s *retryStore) flush() {
+	list := make([]retryEntry, 0, len(s.entries))
+	for _, e := range s.entries {
+		list = append(list, e)
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		log.Printf("retry queue marshal error: %v", err)
+		return
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		log.Printf("retry queue write error: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		log.Printf("retry queue write error: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRetryResumedAfterRestart(t *testing.T) {
+	fc := useFakeClock(t)
+	fs := useFakeSender(t)
+	path := filepath.Join(t.TempDir(), "retries.json")
+	store, err := loadRetryStore(path)
+	if err != nil || len(store.list()) != 0 {
+		t.Fatalf("missing file: %v, %d entries", err, len(store.list()))
+	}
+	swap(t, &pendingRetries, store)
+
+	// Неудачная попытка сохраняется на диск до следующей
+	var onDisk []retryEntry
+	fs.fail = func(_ string, n int) error {
+		if n == 1 {
+			return errors.New("connection refused")
+		}
+		reloaded, err := loadRetryStore(path)
+		if err != nil {
+			t.Error(err)
+			return nil
+		}
+		onDisk = reloaded.list()
+		return nil
+	}
+	sendCallback(context.Background(), "http://receiver/a", "", calcResult{CalculationID: 1, Status: "success"})
+	if len(onDisk) != 1 || onDisk[0].URL != "http://receiver/a" || onDisk[0].Attempt != 1 {
+		t.Fatalf("retry file before the second attempt: %+v", onDisk)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "[]" {
+		t.Fatalf("retry file after delivery: %s", data)
+	}
+
+	// Запись, оставшаяся от прошлого запуска, продолжается с того же места
+	store.save(retryEntry{
+		ID:      "left-over",
+		URL:     "http://receiver/b",
+		Body:    []byte(`{"calculation_id":2}`),
+		Attempt: 2,
+		Backoff: 8 * time.Second,
+		NextAt:  fc.Now().Add(4 * time.Second),
+	})
+	restarted, err := loadRetryStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pendingRetries = restarted
+	fs.fail = nil
+	resumeRetries()
+
+	eventually(t, func() bool { return len(fs.delivered()) == 2 })
+	if got := fs.delivered()[1]; got.URL != "http://receiver/b" || string(got.Payload) != `{"calculation_id":2}` {
+		t.Fatalf("resumed callback = %+v", got)
+	}
+	if got, want := fc.sleeps(), []time.Duration{time.Second, 4 * time.Second}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("sleeps = %v, want %v", got, want)
+	}
+	eventually(t, func() bool { return len(restarted.list()) == 0 })
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// sandboxCallbacks хранит перехваченные колбэки в режиме SANDBOX=true и в этом
+// режиме же служит транспортом колбэков. nil, если режим выключен.
+// Инициализируется в main.
+var sandboxCallbacks *callbackRing
+
+// capturedCallback — колбэк, который в обычном режиме ушёл бы получателю.
+type capturedCallback struct {
+	URL        string          `json:"url"`
+	Payload    json.RawMessage `json:"payload"`
+	CapturedAt time.Time       `json:"captured_at"`
+}
+
+// callbackRing — кольцевой буфер фиксированного размера: при переполнении
+// вытесняются самые старые записи.
+type callbackRing struct {
+	mu    sync.Mutex
+	items []capturedCallback
+	next  int
+	full  bool
+}
+
+func newCallbackRing(size int) *callbackRing {
+	if size <= 0 {
+		size = 1
+	}
+	return &callbackRing{items: make([]capturedCallback, size)}
+}
+
+func (r *callbackRing) add(cb capturedCallback) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.items[r.next] = cb
+	r.next = (r.next + 1) % len(r.items)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Send реализует CallbackSender: колбэк не отправляется, а запоминается.
+func (r *callbackRing) Send(_ context.Context, url string, body []byte) error {
+	r.add(capturedCallback{URL: url, Payload: append(json.RawMessage(nil), body...), CapturedAt: now()})
+	return nil
+}
+
+// list возвращает записи от старых к новым.
+func (r *callbackRing) list() []capturedCallback {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]capturedCallback(nil), r.items[:r.next]...)
+	}
+	out := make([]capturedCallback, 0, len(r.items))
+	out = append(out, r.items[r.next:]...)
+	return append(out, r.items[:r.next]...)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// schemaRequired — обязательные поля, которые проверяются кодом
+// (validateCalcRequest, validateCalculation), а не тегом binding:"required".
+var schemaRequired = map[reflect.Type][]string{
+	reflect.TypeOf(calcRequest{}): {"calculation_id", "callback_url", "services"},
+}
+
+// schemaFormats — форматы строковых полей, которые не выразить тегами.
+var schemaFormats = map[string]string{
+	"callback_url":          "uri",
+	"fallback_callback_url": "uri",
+	"run_at":                "date-time",
+}
+
+// schemaHandler отдаёт JSON Schema тела POST /process. Схема строится по
+// calcRequest отражением, поэтому не расходится с кодом.
+func schemaHandler(c *gin.Context) {
+	schema := typeSchema(reflect.TypeOf(calcRequest{}))
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = "calcRequest"
+	services := schema["properties"].(map[string]any)["services"].(map[string]any)
+	item := services["items"].(map[string]any)["properties"].(map[string]any)
+	item["price_type"].(map[string]any)["enum"] = schemaPriceTypes()
+	c.JSON(http.StatusOK, schema)
+}
+
+// schemaPriceTypes — допустимые price_type: ALLOWED_PRICE_TYPES, если задан,
+// иначе все известные типы.
+func schemaPriceTypes() []string {
+	var types []string
+	if allowedPriceTypes != nil {
+		for priceType := range allowedPriceTypes {
+			types = append(types, priceType)
+		}
+	} else {
+		types = append(types, "daily", "monthly", "yearly", percentOfTotal)
+		for alias := range oneTimePriceTypes {
+			types = append(types, alias)
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+// typeSchema строит схему типа: объекты — по экспортируемым полям с
+// json-тегом, ограничения — по тегу binding.
+func typeSchema(t reflect.Type) map[string]any {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return typeSchema(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+	default:
+		return map[string]any{}
+	}
+
+	props := map[string]any{}
+	required := append([]string(nil), schemaRequired[t]...)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || name == "" || name == "-" {
+			continue
+		}
+		prop := typeSchema(f.Type)
+		if format, ok := schemaFormats[name]; ok {
+			prop["format"] = format
+		}
+		if applyBindingTags(prop, f.Tag.Get("binding")) {
+			required = append(required, name)
+		}
+		props[name] = prop
+	}
+	schema := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema
+}
+
+// applyBindingTags переносит правила из тега binding в схему поля и
+// сообщает, обязательно ли поле. Правила после dive относятся к элементам
+// массива.
+func applyBindingTags(prop map[string]any, tag string) bool {
+	required := false
+	target := prop
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			required = true
+		case "dive":
+			if items, ok := target["items"].(map[string]any); ok {
+				target = items
+			}
+		case "dateonly":
+			target["format"] = "date"
+		case "oneof":
+			target["enum"] = strings.Fields(param)
+		case "min", "max":
+			n, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				continue
+			}
+			key := map[string]string{"min": "minimum", "max": "maximum"}[name]
+			if target["type"] == "array" {
+				key = map[string]string{"min": "minItems", "max": "maxItems"}[name]
+			}
+			target[key] = n
+		}
+	}
+	return required
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestSchemaRequiredFields(t *testing.T) {
+	useStatusStore(t)
+	rec := serve(route(http.MethodGet, "/schema", schemaHandler), http.MethodGet, "/schema", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+	var schema struct {
+		Required   []string `json:"required"`
+		Properties map[string]struct {
+			Format string `json:"format"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &schema); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"calculation_id", "callback_url", "services"}; !reflect.DeepEqual(schema.Required, want) {
+		t.Fatalf("required = %q, want %q", schema.Required, want)
+	}
+	for field, format := range map[string]string{"callback_url": "uri", "fallback_callback_url": "uri", "run_at": "date-time", "start_date": "date"} {
+		if got := schema.Properties[field].Format; got != format {
+			t.Errorf("%s: format %q, want %q", field, got, format)
+		}
+	}
+
+	// Схема не расходится с кодом: без любого обязательного поля /process отвечает 400
+	router := route(http.MethodPost, "/process", processHandler)
+	for _, field := range schema.Required {
+		req := map[string]any{"calculation_id": 1, "callback_url": "http://receiver", "services": []any{}}
+		delete(req, field)
+		body, _ := json.Marshal(req)
+		if rec := serve(router, http.MethodPost, "/process", string(body), "Content-Type", "application/json"); rec.Code != http.StatusBadRequest {
+			t.Errorf("without %s: status %d, want 400", field, rec.Code)
+		}
+	}
+}
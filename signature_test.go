@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSignedRequestFreshness(t *testing.T) {
+	fc := useFakeClock(t)
+	t.Setenv("REQUEST_SIGNING_SECRET", "secret")
+	router := route(http.MethodPost, "/process", verifySignature, func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	send := func(age time.Duration, body, signedBody string) int {
+		ts := fc.Now().Add(-age).Unix()
+		sig := hex.EncodeToString(signRequest("secret", ts, []byte(signedBody)))
+		return serve(router, http.MethodPost, "/process", body, "X-Timestamp", strconv.FormatInt(ts, 10), "X-Signature", sig).Code
+	}
+
+	if code := send(0, `{}`, `{}`); code != http.StatusNoContent {
+		t.Errorf("fresh request: status %d", code)
+	}
+	if code := send(4*time.Minute, `{}`, `{}`); code != http.StatusNoContent {
+		t.Errorf("4 minutes old: status %d", code)
+	}
+	if code := send(6*time.Minute, `{}`, `{}`); code != http.StatusUnauthorized {
+		t.Errorf("6 minutes old: status %d, want 401", code)
+	}
+	if code := send(0, `{"a":1}`, `{}`); code != http.StatusUnauthorized {
+		t.Errorf("tampered body: status %d, want 401", code)
+	}
+
+	t.Setenv("SIGNATURE_MAX_AGE", "10m")
+	if code := send(6*time.Minute, `{}`, `{}`); code != http.StatusNoContent {
+		t.Errorf("6 minutes old with SIGNATURE_MAX_AGE=10m: status %d", code)
+	}
+
+	if rec := serve(router, http.MethodPost, "/process", `{}`, "X-Timestamp", "yesterday"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("malformed X-Timestamp: status %d, want 401", rec.Code)
+	}
+	t.Setenv("REQUEST_SIGNING_SECRET", "")
+	if rec := serve(router, http.MethodPost, "/process", `{}`); rec.Code != http.StatusNoContent {
+		t.Errorf("signing disabled: status %d", rec.Code)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import "sync"
+
+// stats — агрегаты по обработанным заявкам с момента запуска.
+var stats serviceStats
+
+// serviceStats — накопительная статистика, обновляется в handleAsync.
+type serviceStats struct {
+	mu            sync.Mutex
+	total         int
+	successes     int
+	failures      int
+	sumTotalCost  float64
+	sumDurationMo int
+	// durations — успешные заявки с duration_months: у заявок только из
+	// разовых услуг его нет, и они не должны занижать среднее.
+	durations int
+}
+
+// statsSnapshot — ответ GET /admin/stats. Средние считаются по успешным
+// заявкам, средняя длительность — только по тем, у которых она есть.
+type statsSnapshot struct {
+	TotalRequests     int     `json:"total_requests"`
+	Successes         int     `json:"successes"`
+	Failures          int     `json:"failures"`
+	AvgTotalCost      float64 `json:"avg_total_cost"`
+	AvgDurationMonths float64 `json:"avg_duration_months"`
+}
+
+func (s *serviceStats) record(result calcResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.total++
+	if result.Status != "success" {
+		s.failures++
+		return
+	}
+	s.successes++
+	if result.TotalCost != nil {
+		s.sumTotalCost += *result.TotalCost
+	}
+	if result.DurationMonths != nil {
+		s.sumDurationMo += *result.DurationMonths
+		s.durations++
+	}
+}
+
+func (s *serviceStats) snapshot() statsSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap := statsSnapshot{
+		TotalRequests: s.total,
+		Successes:     s.successes,
+		Failures:      s.failures,
+	}
+	if s.successes > 0 {
+		snap.AvgTotalCost = s.sumTotalCost / float64(s.successes)
+	}
+	if s.durations > 0 {
+		snap.AvgDurationMonths = float64(s.sumDurationMo) / float64(s.durations)
+	}
+	return snap
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// jobs — статусы принятых заявок по calculation_id.
+var jobs = newStatusStore()
+
+// jobStatus — состояние заявки для GET /status/:id.
+type jobStatus struct {
+	CalculationID int         `json:"calculation_id"`
+	Status        string      `json:"status"`   // pending, success, failure, cancelled
+	Progress      int         `json:"progress"` // 0–100
+	Result        *calcResult `json:"result,omitempty"`
+	CreatedAt     time.Time   `json:"created_at"`
+	UpdatedAt     time.Time   `json:"updated_at"`
+	// DeliveredTo — адрес, принявший итоговый колбэк: callback_url или
+	// fallback_callback_url (без учётных данных).
+	DeliveredTo string `json:"delivered_to,omitempty"`
+	// request — исходная заявка для повторного запуска (replay).
+	request calcRequest
+	// batch — заявка пришла из /process/batch или /process/batch/stream,
+	// и replay ставит её в batchPool, а не в пул одиночных заявок.
+	batch bool
+}
+
+type statusStore struct {
+	mu   sync.Mutex
+	jobs map[int]*jobStatus
+	// ttl — сколько хранить завершённые заявки (STATUS_TTL, по умолчанию
+	// сутки); 0 — бессрочно.
+	ttl time.Duration
+}
+
+func newStatusStore() *statusStore {
+	return &statusStore{jobs: map[int]*jobStatus{}}
+}
+
+// start регистрирует заявку как pending; повторная заявка с тем же ID
+// заменяет прежнюю запись.
+func (s *statusStore) start(req calcRequest) {
+	s.register(req, false)
+}
+
+// startBatch — start для заявки пакета.
+func (s *statusStore) startBatch(req calcRequest) {
+	s.register(req, true)
+}
+
+func (s *statusStore) register(req calcRequest, batch bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	createdAt := now()
+	s.jobs[req.CalculationID] = &jobStatus{
+		CalculationID: req.CalculationID,
+		Status:        "pending",
+		CreatedAt:     createdAt,
+		UpdatedAt:     createdAt,
+		request:       req,
+		batch:         batch,
+	}
+}
+
+// restart снова переводит завершённую заявку в pending и возвращает копию
+// новой записи для повторного запуска. Проверка и перевод — под одной
+// блокировкой, чтобы два одновременных replay не запустили заявку дважды.
+func (s *statusStore) restart(id int) (jobStatus, *APIError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	switch {
+	case !ok:
+		return jobStatus{}, errNotFound("calculation not found")
+	case j.Status == "pending":
+		return jobStatus{}, errConflict("calculation is still pending")
+	case j.request.CallbackURL == "":
+		return jobStatus{}, errValidation("calculation has no callback_url to replay to")
+	}
+	createdAt := now()
+	s.jobs[id] = &jobStatus{
+		CalculationID: id,
+		Status:        "pending",
+		CreatedAt:     createdAt,
+		UpdatedAt:     createdAt,
+		request:       j.request,
+		batch:         j.batch,
+	}
+	return *s.jobs[id], nil
+}
+
+func (s *statusStore) finish(id int, result calcResult) {
+	s.update(id, func(j *jobStatus) {
+		j.Status = result.Status
+		j.Result = &result
+		j.Progress = 100
+	})
+}
+
+func (s *statusStore) delivered(id int, url string) {
+	s.update(id, func(j *jobStatus) { j.DeliveredTo = redactURL(url) })
+}
+
+func (s *statusStore) cancel(id int) {
+	s.update(id, func(j *jobStatus) { j.Status = "cancelled" })
+}
+
+func (s *statusStore) update(id int, fn func(*jobStatus)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok {
+		return
+	}
+	fn(j)
+	j.UpdatedAt = now()
+}
+
+func (s *statusStore) setProgress(id, progress int) {
+	s.update(id, func(j *jobStatus) { j.Progress = progress })
+}
+
+// sweep удаляет завершённые заявки, не обновлявшиеся дольше ttl.
+// Ожидающие заявки не удаляются.
+func (s *statusStore) sweep(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ttl <= 0 {
+		return 0
+	}
+	removed := 0
+	for id, j := range s.jobs {
+		if j.Status != "pending" && now.Sub(j.UpdatedAt) >= s.ttl {
+			delete(s.jobs, id)
+			removed++
+		}
+	}
+	return removed
+}
+
+// get возвращает копию статуса.
+func (s *statusStore) get(id int) (jobStatus, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok {
+		return jobStatus{}, false
+	}
+	return *j, true
+}
+
+// pendingJobs — отмена ожидающих заявок (POST /admin/cancel-all).
+var pendingJobs = newJobRegistry()
+
+// jobRegistry хранит функции отмены заявок, которые ещё ждут расчёта.
+type jobRegistry struct {
+	mu      sync.Mutex
+	nextID  uint64
+	cancels map[uint64]context.CancelFunc
+}
+
+func newJobRegistry() *jobRegistry {
+	return &jobRegistry{cancels: map[uint64]context.CancelFunc{}}
+}
+
+// track возвращает отменяемый контекст заявки и функцию снятия с учёта.
+func (r *jobRegistry) track(parent context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(parent)
+	r.mu.Lock()
+	id := r.nextID
+	r.nextID++
+	r.cancels[id] = cancel
+	r.mu.Unlock()
+	return ctx, func() {
+		r.mu.Lock()
+		delete(r.cancels, id)
+		r.mu.Unlock()
+		cancel()
+	}
+}
+
+// cancelAll отменяет все ожидающие заявки и возвращает их число.
+func (r *jobRegistry) cancelAll() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := len(r.cancels)
+	for id, cancel := range r.cancels {
+		cancel()
+		delete(r.cancels, id)
+	}
+	return n
+}
+
+// trackProgress имитирует прогресс заявки: ожидание wait делится на steps
+// шагов, после каждого progress растёт (до 99 — 100 ставит finish).
+// Возвращённая функция останавливает обновление.
+func trackProgress(id int, wait time.Duration, steps int) func() {
+	if steps <= 0 || wait/time.Duration(steps) <= 0 {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	go func() {
+		for step := 1; step < steps; step++ {
+			select {
+			case <-clock.After(wait / time.Duration(steps)):
+				jobs.setProgress(id, min(99, step*100/steps))
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return func() { close(stop) }
+}
+
+// statusLocation — адрес ресурса статуса заявки (для заголовка Location).
+func statusLocation(id int) string {
+	return "/status/" + strconv.Itoa(id)
+}
+
+func statusHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		writeError(c, errBadRequest("id must be an integer"))
+		return
+	}
+	status, ok := jobs.get(id)
+	if !ok {
+		writeError(c, errNotFound("calculation not found"))
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// statusEventsHandler отдаёт статус заявки потоком Server-Sent Events: событие
+// pending (повторяется при изменении progress), затем итоговое success,
+// failure или cancelled, после чего поток закрывается. Если результата нет
+// дольше SSE_TIMEOUT (60 секунд), приходит событие timeout.
+func statusEventsHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		writeError(c, errBadRequest("id must be an integer"))
+		return
+	}
+	status, ok := jobs.get(id)
+	if !ok {
+		writeError(c, errNotFound("calculation not found"))
+		return
+	}
+
+	poll := getEnvDuration("SSE_POLL_INTERVAL", 200*time.Millisecond)
+	timeout := clock.After(getEnvDuration("SSE_TIMEOUT", time.Minute))
+
+	c.Header("Cache-Control", "no-cache")
+	lastProgress := -1
+	for {
+		if status.Status != "pending" {
+			c.SSEvent(status.Status, status)
+			c.Writer.Flush()
+			return
+		}
+		if status.Progress != lastProgress {
+			lastProgress = status.Progress
+			c.SSEvent(status.Status, status)
+			c.Writer.Flush()
+		}
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-timeout:
+			c.SSEvent("timeout", gin.H{"calculation_id": id})
+			c.Writer.Flush()
+			return
+		case <-clock.After(poll):
+		}
+		status, _ = jobs.get(id)
+	}
+}
+
+// replayHandler повторно запускает сохранённую заявку: новый расчёт, новый
+// случайный исход и новый колбэк. Заявка с Idempotency-Key вместо нового
+// расчёта получает сохранённый результат. Ожидающую заявку повторить
+// нельзя — получатель получил бы два колбэка, как и заявку из
+// /process/batch/stream, у которой нет callback_url.
+func replayHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		writeError(c, errBadRequest("id must be an integer"))
+		return
+	}
+	status, apiErr := jobs.restart(id)
+	if apiErr != nil {
+		writeError(c, apiErr)
+		return
+	}
+	pool := workers
+	if status.batch {
+		pool = batchPool()
+	}
+	scheduleAsync(jobsCtx, pool, status.request)
+
+	c.Header("Location", statusLocation(id))
+	c.JSON(http.StatusAccepted, gin.H{"message": "scheduled"})
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useStatusStore подменяет jobs чистым хранилищем на время теста.
+func useStatusStore(t *testing.T) *statusStore {
+	t.Helper()
+	swap(t, &jobs, newStatusStore())
+	return jobs
+}
+
+func TestReplaySendsNewCallback(t *testing.T) {
+	useDeterministic(t)
+	store := useStatusStore(t)
+	fs := useFakeSender(t)
+	router := route(http.MethodPost, "/process/:id/replay", replayHandler)
+
+	req := calcRequest{CalculationID: 9, CallbackURL: "http://receiver", Services: []serviceItem{}}
+	store.start(req)
+	store.finish(9, calcResult{CalculationID: 9, Status: "failure"})
+
+	rec := serve(router, http.MethodPost, "/process/9/replay", "")
+	if rec.Code != http.StatusAccepted || rec.Header().Get("Location") != "/status/9" {
+		t.Fatalf("replay: status %d, Location %q", rec.Code, rec.Header().Get("Location"))
+	}
+	waitDelivered(t, 9)
+	sent := fs.delivered()
+	if len(sent) != 1 || sent[0].URL != "http://receiver" || decodeResult(t, sent[0]).Status != "success" {
+		t.Fatalf("replay callbacks = %+v", sent)
+	}
+}
+
+func TestReplayKeepsBatchJobsOnBatchPool(t *testing.T) {
+	useDeterministic(t)
+	store := useStatusStore(t)
+	useFakeSender(t)
+	useWorkerPool(t, 1)
+	swap(t, &batchWorkers, newWorkerPool(1))
+	router := route(http.MethodPost, "/process/:id/replay", replayHandler)
+
+	// Единственный обработчик одиночных заявок занят
+	release := make(chan struct{})
+	defer close(release)
+	workers.submit(context.Background(), "", func(context.Context) { <-release })
+
+	req := calcRequest{CalculationID: 4, CallbackURL: "http://receiver", Services: []serviceItem{}}
+	store.startBatch(req)
+	store.finish(4, calcResult{CalculationID: 4, Status: "failure"})
+	if rec := serve(router, http.MethodPost, "/process/4/replay", ""); rec.Code != http.StatusAccepted {
+		t.Fatalf("replay: status %d", rec.Code)
+	}
+	waitDelivered(t, 4)
+}
+
+func TestReplayRejectsPendingAndStreamJobs(t *testing.T) {
+	store := useStatusStore(t)
+	router := route(http.MethodPost, "/process/:id/replay", replayHandler)
+
+	store.start(calcRequest{CalculationID: 1, CallbackURL: "http://receiver"})
+	if rec := serve(router, http.MethodPost, "/process/1/replay", ""); rec.Code != http.StatusConflict {
+		t.Errorf("pending job: status %d, want 409", rec.Code)
+	}
+
+	// Заявка из /process/batch/stream — без callback_url
+	store.start(calcRequest{CalculationID: 2})
+	store.finish(2, calcResult{CalculationID: 2, Status: "success"})
+	if rec := serve(router, http.MethodPost, "/process/2/replay", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("job without callback_url: status %d, want 400", rec.Code)
+	}
+
+	if rec := serve(router, http.MethodPost, "/process/3/replay", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown job: status %d, want 404", rec.Code)
+	}
+}
+
+func TestProgressPolling(t *testing.T) {
+	fc := useFakeClock(t)
+	useStatusStore(t)
+	useFakeSender(t)
+	swap(t, &failureRate, 0.0)
+	t.Setenv("DELAY_DISTRIBUTION", "fixed")
+	t.Setenv("DELAY_MEAN", "4s")
+	t.Setenv("PROGRESS_STEPS", "4")
+	router := route(http.MethodGet, "/status/:id", statusHandler)
+	poll := func() jobStatus {
+		var status jobStatus
+		rec := serve(router, http.MethodGet, "/status/1", "")
+		if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+			t.Fatalf("GET /status/1: %d %s", rec.Code, rec.Body)
+		}
+		return status
+	}
+
+	req := calcRequest{CalculationID: 1, CallbackURL: "http://receiver"}
+	jobs.start(req)
+	if status := poll(); status.Status != "pending" || status.Progress != 0 {
+		t.Fatalf("before start: %+v", status)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runJob(context.Background(), req)
+	}()
+
+	for _, want := range []int{25, 50, 75} {
+		// Шаг прогресса и сама задержка
+		fc.waitForWaiters(t, 2)
+		fc.Advance(time.Second)
+		eventually(t, func() bool { return poll().Progress == want })
+	}
+	fc.Advance(time.Second)
+	<-done
+	if status := poll(); status.Status != "success" || status.Progress != 100 {
+		t.Fatalf("after finish: %+v", status)
+	}
+}
+
+func TestStatusEventsStream(t *testing.T) {
+	fc := useFakeClock(t)
+	store := useStatusStore(t)
+	store.start(calcRequest{CalculationID: 3})
+	router := route(http.MethodGet, "/process/:id/events", statusEventsHandler)
+
+	var rec *httptest.ResponseRecorder
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		rec = serve(router, http.MethodGet, "/process/3/events", "")
+	}()
+
+	// Тайм-аут потока и очередной опрос; без изменений событие не повторяется
+	fc.waitForWaiters(t, 2)
+	store.setProgress(3, 40)
+	fc.Advance(200 * time.Millisecond)
+	fc.waitForWaiters(t, 2)
+	fc.Advance(200 * time.Millisecond)
+	fc.waitForWaiters(t, 2)
+	store.finish(3, calcResult{CalculationID: 3, Status: "success"})
+	fc.Advance(200 * time.Millisecond)
+	<-done
+
+	var events []string
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if name, ok := strings.CutPrefix(line, "event:"); ok {
+			events = append(events, name)
+		}
+	}
+	if strings.Join(events, ",") != "pending,pending,success" || !strings.Contains(rec.Body.String(), `"progress":40`) {
+		t.Fatalf("unexpected stream:\n%s", rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	if rec := serve(router, http.MethodGet, "/process/4/events", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown calculation: status %d, want 404", rec.Code)
+	}
+}
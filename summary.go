@@ -0,0 +1,59 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// defaultSummaryTemplate — summary по умолчанию, например
+// "12 months, 3 services, total 1499.00 EUR".
+const defaultSummaryTemplate = `{{if .Months}}{{.Months}} months, {{end}}{{.Services}} services, total {{.Total}}{{if .Currency}} {{.Currency}}{{end}}`
+
+// summaryTemplate — шаблон summary (SUMMARY_TEMPLATE, text/template).
+// Инициализируется в main.
+var summaryTemplate = template.Must(template.New("summary").Parse(defaultSummaryTemplate))
+
+// loadSummaryTemplate разбирает SUMMARY_TEMPLATE. Ошибочный шаблон не
+// должен ронять расчёты, поэтому вместо него берётся шаблон по умолчанию.
+func loadSummaryTemplate(text string) *template.Template {
+	tmpl, err := template.New("summary").Parse(text)
+	if err != nil {
+		log.Printf("SUMMARY_TEMPLATE: %v; using the default template", err)
+		return template.Must(template.New("summary").Parse(defaultSummaryTemplate))
+	}
+	return tmpl
+}
+
+// summaryData — поля, доступные в SUMMARY_TEMPLATE.
+type summaryData struct {
+	// Months — длительность; 0 у заявки только из разовых услуг.
+	Months   int
+	Services int
+	// Total — итог, отформатированный с точностью валюты.
+	Total    string
+	Currency string
+}
+
+// buildSummary формирует однострочное описание успешного результата или
+// пустую строку, если итога нет.
+func buildSummary(req calcRequest, result calcResult) string {
+	if result.TotalCost == nil {
+		return ""
+	}
+	data := summaryData{
+		Services: len(req.Services),
+		Total:    strconv.FormatFloat(*result.TotalCost, 'f', currencyPrecision(result.Currency), 64),
+		Currency: result.Currency,
+	}
+	if result.DurationMonths != nil {
+		data.Months = *result.DurationMonths
+	}
+	var sb strings.Builder
+	if err := summaryTemplate.Execute(&sb, data); err != nil {
+		log.Printf("calculation %d: SUMMARY_TEMPLATE: %v", req.CalculationID, err)
+		return ""
+	}
+	return sb.String()
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// tracer — источник спанов сервиса. Пока setupTracing не включил экспорт,
+// спаны no-op, но контекст трассировки всё равно передаётся дальше.
+var tracer = otel.Tracer(serviceName)
+
+// setupTracing включает экспорт трассировки по OTLP/HTTP, если задан
+// OTEL_EXPORTER_OTLP_ENDPOINT (остальные OTEL_EXPORTER_OTLP_* экспортёр
+// читает сам). Пропагатор W3C traceparent ставится всегда. Возвращает
+// функцию, которая дописывает накопленные спаны при остановке.
+func setupTracing(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("otlp exporter: %w", err)
+	}
+	resource := sdkresource.NewSchemaless(
+		semconv.ServiceName(serviceName),
+		semconv.ServiceVersion(serviceVersion),
+	)
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// extractTrace продолжает трассировку клиента, если он передал traceparent.
+func extractTrace(ctx context.Context, header http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// injectTrace добавляет traceparent в заголовки исходящего колбэка.
+func injectTrace(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestProcessCreatesSpans(t *testing.T) {
+	useDeterministic(t)
+	useStatusStore(t)
+	useFakeSender(t)
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	swap(t, &tracer, provider.Tracer(serviceName))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	body := `{"calculation_id": 61, "callback_url": "http://receiver", "services": []}`
+	rec := serve(route(http.MethodPost, "/process", processHandler), http.MethodPost, "/process", body,
+		"Content-Type", "application/json",
+		"traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	waitDelivered(t, 61)
+	// handleAsync закрывает спан уже после доставки
+	eventually(t, func() bool { return len(exporter.GetSpans()) == 4 })
+
+	var names []string
+	for _, span := range exporter.GetSpans() {
+		names = append(names, span.Name)
+		if got := span.SpanContext.TraceID().String(); got != traceID {
+			t.Errorf("span %s: trace %s, want the client's %s", span.Name, got, traceID)
+		}
+	}
+	sort.Strings(names)
+	want := []string{"calculate", "handleAsync", "processHandler", "sendCallback"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("spans = %q, want %q", names, want)
+	}
+}
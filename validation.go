@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// dateLayout — документированный формат start_date/end_date.
+const dateLayout = "2006-01-02"
+
+// Ограничения на metadata заявки.
+const (
+	maxMetadataEntries  = 20
+	maxMetadataKeyLen   = 64
+	maxMetadataValueLen = 256
+)
+
+func validateMetadata(md map[string]string) error {
+	if len(md) > maxMetadataEntries {
+		return fmt.Errorf("metadata: at most %d entries allowed", maxMetadataEntries)
+	}
+	for k, v := range md {
+		if k == "" || len(k) > maxMetadataKeyLen {
+			return fmt.Errorf("metadata: key length must be 1-%d bytes", maxMetadataKeyLen)
+		}
+		if len(v) > maxMetadataValueLen {
+			return fmt.Errorf("metadata %q: value must be at most %d bytes", k, maxMetadataValueLen)
+		}
+	}
+	return nil
+}
+
+// validateRunAt проверяет формат run_at и что он не дальше RUN_AT_MAX_AHEAD.
+func validateRunAt(runAt string) error {
+	if runAt == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, runAt)
+	if err != nil {
+		return errors.New("run_at: must be an RFC3339 timestamp")
+	}
+	if maxAhead := getEnvDuration("RUN_AT_MAX_AHEAD", 24*time.Hour); t.Sub(clock.Now()) > maxAhead {
+		return fmt.Errorf("run_at: must be at most %s in the future", maxAhead)
+	}
+	return nil
+}
+
+func parseDateOnly(value string) (time.Time, error) {
+	return time.Parse(dateLayout, value)
+}
+
+// registerValidators подключает к биндингу Gin собственные правила валидации
+// и имена полей из json-тегов для сообщений об ошибках.
+func registerValidators() error {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return errors.New("unexpected validator engine")
+	}
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	return v.RegisterValidation("dateonly", func(fl validator.FieldLevel) bool {
+		_, err := parseDateOnly(fl.Field().String())
+		return err == nil
+	})
+}
+
+// requireBody отклоняет запрос с пустым телом до биндинга: прокси иногда
+// молча теряют тело, и понятное "empty request body" лучше общего
+// "bad request". Без Content-Length (chunked) тело проверяется чтением
+// первого байта, который затем возвращается в поток.
+func requireBody(c *gin.Context) {
+	if c.Request.ContentLength == 0 || c.Request.Body == nil {
+		writeError(c, errBadRequest("empty request body"))
+		return
+	}
+	if c.Request.ContentLength < 0 {
+		br := bufio.NewReader(c.Request.Body)
+		if _, err := br.Peek(1); err != nil {
+			writeError(c, errBadRequest("empty request body"))
+			return
+		}
+		c.Request.Body = struct {
+			io.Reader
+			io.Closer
+		}{br, c.Request.Body}
+	}
+	c.Next()
+}
+
+// UnmarshalJSON разбирает заявку как обычно и запоминает хеш присланного
+// объекта для request_hash: и для тела /process, и для элемента пакета.
+// Вложенный json.Unmarshal не наследует DisallowUnknownFields внешнего
+// декодера, поэтому STRICT_JSON применяется здесь повторно.
+func (r *calcRequest) UnmarshalJSON(data []byte) error {
+	type plain calcRequest
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if getEnvBool("STRICT_JSON", false) {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode((*plain)(r)); err != nil {
+		return err
+	}
+	r.rawHash = canonicalRequestHash(data)
+	return nil
+}
+
+// bindJSON — строгая замена ShouldBindJSON: тело должно содержать ровно
+// один JSON-объект, склеенные объекты и мусор после него отклоняются.
+// Неизвестные поля по умолчанию игнорируются, а при STRICT_JSON — тоже
+// ошибка: так опечатка клиента в имени поля видна сразу, а не теряется.
+func bindJSON(c *gin.Context, obj any) *APIError {
+	dec := json.NewDecoder(c.Request.Body)
+	if getEnvBool("STRICT_JSON", false) {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(obj); err != nil {
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			return errBadRequest("unknown field " + field)
+		}
+		return errBadRequest("bad request")
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errBadRequest("unexpected data after JSON object")
+	}
+	if err := binding.Validator.ValidateStruct(obj); err != nil {
+		return bindingError(err)
+	}
+	return nil
+}
+
+// bindingError превращает ошибку биндинга в понятную клиенту ошибку
+// с указанием поля, если она пришла от валидатора.
+func bindingError(err error) *APIError {
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return errBadRequest("bad request")
+	}
+	msgs := make([]string, 0, len(verrs))
+	for _, fe := range verrs {
+		field := fe.Field()
+		// Для вложенных полей показываем путь: services[0].start_date
+		if _, path, ok := strings.Cut(fe.Namespace(), "."); ok {
+			field = path
+		}
+		switch fe.Tag() {
+		case "dateonly":
+			msgs = append(msgs, fmt.Sprintf("%s: must be a date in YYYY-MM-DD format", field))
+		case "min":
+			msgs = append(msgs, fmt.Sprintf("%s: must be at least %s", field, fe.Param()))
+		case "max":
+			msgs = append(msgs, fmt.Sprintf("%s: must be at most %s", field, fe.Param()))
+		case "oneof":
+			msgs = append(msgs, fmt.Sprintf("%s: must be one of: %s", field, fe.Param()))
+		default:
+			msgs = append(msgs, fmt.Sprintf("%s: failed %s validation", field, fe.Tag()))
+		}
+	}
+	return errValidation(strings.Join(msgs, "; "))
+}
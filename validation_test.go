@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bindBody разбирает body через bindJSON, как это делают обработчики.
+func bindBody(body string, obj any) *APIError {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	return bindJSON(c, obj)
+}
+
+func TestDateOnlyBinding(t *testing.T) {
+	for _, date := range []string{"2025-01-31", "2024-02-29"} {
+		var req calcRequest
+		if err := bindBody(`{"start_date": "`+date+`"}`, &req); err != nil {
+			t.Errorf("start_date %q: %v", date, err)
+		}
+	}
+	for _, date := range []string{"2025-13-01", "2025-02-30", "31.01.2025", "2025-1-5", "2025-01-31T00:00:00Z"} {
+		var req calcRequest
+		err := bindBody(`{"start_date": "`+date+`"}`, &req)
+		if err == nil || err.Status != http.StatusBadRequest || err.Message != "start_date: must be a date in YYYY-MM-DD format" {
+			t.Errorf("start_date %q: err = %+v, want a dateonly validation error", date, err)
+		}
+	}
+
+	// Для строки услуги в сообщении — путь к полю
+	var req calcRequest
+	err := bindBody(`{"services": [{"id": 1, "end_date": "tomorrow"}]}`, &req)
+	if err == nil || err.Message != "services[0].end_date: must be a date in YYYY-MM-DD format" {
+		t.Fatalf("services[0].end_date: err = %+v", err)
+	}
+}
+
+func TestMetadataRoundTripAndCaps(t *testing.T) {
+	useDeterministic(t)
+	md := map[string]string{"customer_id": "c-42", "environment": "staging"}
+	result := computeResult(calcRequest{CalculationID: 1, Metadata: md, Services: []serviceItem{}})
+	if !reflect.DeepEqual(result.Metadata, md) {
+		t.Fatalf("metadata = %v, want %v", result.Metadata, md)
+	}
+	// Неуспешный результат тоже несёт metadata
+	swap(t, &deterministic, false)
+	t.Setenv("MAX_TOTAL_COST", "1")
+	result = computeResult(calcRequest{CalculationID: 1, Metadata: md, Services: []serviceItem{{ID: 1, Price: 10, PriceType: "one_time", Quantity: 1}}})
+	if result.Status != "failure" || !reflect.DeepEqual(result.Metadata, md) {
+		t.Fatalf("failure: status %s, metadata %v", result.Status, result.Metadata)
+	}
+
+	tooMany := map[string]string{}
+	for i := 0; i <= maxMetadataEntries; i++ {
+		tooMany[fmt.Sprint("k", i)] = "v"
+	}
+	for name, md := range map[string]map[string]string{
+		"too many entries": tooMany,
+		"empty key":        {"": "v"},
+		"long key":         {strings.Repeat("k", maxMetadataKeyLen+1): "v"},
+		"long value":       {"k": strings.Repeat("v", maxMetadataValueLen+1)},
+	} {
+		if err := validateMetadata(md); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+	if err := validateMetadata(map[string]string{strings.Repeat("k", maxMetadataKeyLen): strings.Repeat("v", maxMetadataValueLen)}); err != nil {
+		t.Errorf("metadata at the limits: %v", err)
+	}
+}
+
+func TestInfinitePriceRejected(t *testing.T) {
+	// В JSON бесконечность приходит как число вне диапазона float64
+	router := route(http.MethodPost, "/process", processHandler)
+	for _, body := range []string{
+		`{"calculation_id": 1, "callback_url": "http://receiver", "services": [{"id": 1, "price": 1e400, "price_type": "monthly", "quantity": 1}]}`,
+		// Даже в режиме partial такая строка не пропускается, а отклоняет заявку
+		`{"calculation_id": 1, "callback_url": "http://receiver", "partial": true, "services": [{"id": 1, "price": 1e400, "price_type": "monthly", "quantity": 1}]}`,
+	} {
+		if rec := serve(router, http.MethodPost, "/process", body, "X-ASYNC-TOKEN", "async-secret", "Content-Type", "application/json"); rec.Code != http.StatusBadRequest {
+			t.Fatalf("price 1e400: status %d, want 400", rec.Code)
+		}
+	}
+
+	for _, price := range []float64{math.Inf(1), math.Inf(-1), math.NaN()} {
+		if err := validateService(serviceItem{ID: 7, Price: price, PriceType: "monthly", Quantity: 1}); err == nil || err.Error() != "price must be a finite number" {
+			t.Errorf("price %v: err = %v", price, err)
+		}
+	}
+}
+
+func TestBindJSONRejectsUnknownFieldAndTrailingData(t *testing.T) {
+	t.Setenv("STRICT_JSON", "true")
+	var req calcRequest
+	err := bindBody(`{"calculation_id": 1, "callback_url": "http://receiver", "services": [], "callbak": "x"}`, &req)
+	if err == nil || err.Status != http.StatusBadRequest || err.Message != `unknown field "callbak"` {
+		t.Fatalf("unknown field: %+v", err)
+	}
+
+	for _, body := range []string{
+		`{"calculation_id": 1, "callback_url": "http://receiver", "services": []} trailing`,
+		`{"calculation_id": 1, "callback_url": "http://receiver", "services": []}{}`,
+	} {
+		err := bindBody(body, &calcRequest{})
+		if err == nil || err.Status != http.StatusBadRequest || err.Message != "unexpected data after JSON object" {
+			t.Errorf("%s: %+v", body, err)
+		}
+	}
+
+	// Пробелы и перевод строки после объекта — не лишние данные
+	if err := bindBody("{\"calculation_id\": 1, \"callback_url\": \"http://receiver\", \"services\": []}\n  ", &calcRequest{}); err != nil {
+		t.Fatalf("trailing whitespace: %+v", err)
+	}
+}
+
+func TestStrictJSONToggle(t *testing.T) {
+	useDeterministic(t)
+	useStatusStore(t)
+	useFakeSender(t)
+	router := route(http.MethodPost, "/process", processHandler)
+	body := `{"calculation_id": 71, "callback_url": "http://receiver", "services": [], "client_ref": "abc"}`
+
+	rec := serve(router, http.MethodPost, "/process", body, "Content-Type", "application/json")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("lenient: status %d: %s", rec.Code, rec.Body)
+	}
+	waitDelivered(t, 71)
+
+	t.Setenv("STRICT_JSON", "true")
+	rec = serve(router, http.MethodPost, "/process", body, "Content-Type", "application/json")
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `unknown field \"client_ref\"`) {
+		t.Fatalf("strict: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestRequireBodyRejectsEmpty(t *testing.T) {
+	var got string
+	router := route(http.MethodPost, "/process", requireBody, func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		got = string(body)
+		c.Status(http.StatusNoContent)
+	})
+	send := func(body io.Reader, length int64) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/process", body)
+		req.ContentLength = length
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := send(http.NoBody, 0); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "empty request body") {
+		t.Errorf("empty body: %d %s", rec.Code, rec.Body)
+	}
+	// Chunked: длина неизвестна, пустоту видно только при чтении
+	if rec := send(strings.NewReader(""), -1); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "empty request body") {
+		t.Errorf("empty chunked body: %d %s", rec.Code, rec.Body)
+	}
+	if rec := send(strings.NewReader(`{"calculation_id": 1}`), -1); rec.Code != http.StatusNoContent || got != `{"calculation_id": 1}` {
+		t.Errorf("chunked body: %d, handler read %q", rec.Code, got)
+	}
+}
+
+func TestRequireExplicitDuration(t *testing.T) {
+	monthly := serviceItem{ID: 1, Price: 10, PriceType: "Monthly", Quantity: 1}
+	oneTime := serviceItem{ID: 2, Price: 50, PriceType: "one_time", Quantity: 1}
+	withDates := monthly
+	withDates.StartDate, withDates.EndDate = "2025-01-01", "2025-04-01"
+	cases := []struct {
+		name string
+		req  calcRequest
+		err  string
+	}{
+		{"no dates", calcRequest{Services: []serviceItem{monthly}}, "service 1: monthly service needs start_date and end_date (require_explicit_duration)"},
+		{"request dates", calcRequest{StartDate: "2025-01-01", EndDate: "2025-04-01", Services: []serviceItem{monthly}}, ""},
+		{"line dates", calcRequest{Services: []serviceItem{withDates}}, ""},
+		{"one-time only", calcRequest{Services: []serviceItem{oneTime}}, ""},
+	}
+	for _, tc := range cases {
+		tc.req.RequireExplicitDuration = true
+		got := ""
+		if err := validateCalculation(tc.req); err != nil {
+			got = err.Error()
+		}
+		if got != tc.err {
+			t.Errorf("%s: err = %q, want %q", tc.name, got, tc.err)
+		}
+	}
+
+	// Без флага период по умолчанию — 12 месяцев
+	if err := validateCalculation(calcRequest{Services: []serviceItem{monthly}}); err != nil {
+		t.Fatalf("without require_explicit_duration: %v", err)
+	}
+}